@@ -47,13 +47,18 @@ func (buffer *LogBuffer) WriteMessage(msg *json.RawMessage) error {
 	return nil
 }
 
-func (buffer *LogBuffer) Attach(sink *websocket.Conn) {
+// Attach replays the buffer to the sink and then, unless the buffer is
+// closed, registers it for further messages. It returns once the replay is
+// done; the sink stays attached until it is detached, a write to it fails,
+// or the buffer is closed.
+func (buffer *LogBuffer) Attach(sink *websocket.Conn) error {
 	buffer.contentMutex.Lock()
+	defer buffer.contentMutex.Unlock()
 
 	for _, msg := range buffer.content {
 		err := sink.WriteJSON(msg)
 		if err != nil {
-			return
+			return err
 		}
 	}
 
@@ -63,9 +68,26 @@ func (buffer *LogBuffer) Attach(sink *websocket.Conn) {
 		buffer.sinks = append(buffer.sinks, sink)
 	}
 
-	buffer.contentMutex.Unlock()
+	return nil
+}
+
+// Detach stops writing to the sink. It is a no-op if the sink is not
+// attached.
+func (buffer *LogBuffer) Detach(sink *websocket.Conn) {
+	buffer.contentMutex.Lock()
+	defer buffer.contentMutex.Unlock()
+
+	for i, attached := range buffer.sinks {
+		if attached == sink {
+			buffer.sinks = append(buffer.sinks[:i], buffer.sinks[i+1:]...)
+			return
+		}
+	}
+}
 
-	<-buffer.waitForClosed
+// Closed returns a channel that is closed once the buffer is.
+func (buffer *LogBuffer) Closed() <-chan struct{} {
+	return buffer.waitForClosed
 }
 
 func (buffer *LogBuffer) Close() error {
@@ -2,22 +2,111 @@ package api
 
 import (
 	"net/http"
+	"time"
 
 	"github.com/pivotal-golang/lager"
 	"github.com/tedsuo/rata"
 
 	"github.com/concourse/glider/api/handler"
+	"github.com/concourse/glider/auth"
+	"github.com/concourse/glider/drain"
+	"github.com/concourse/glider/metrics"
+	"github.com/concourse/glider/policy"
+	"github.com/concourse/glider/quota"
+	"github.com/concourse/glider/ratelimit"
 	"github.com/concourse/glider/routes"
+	"github.com/concourse/glider/secrets"
+	"github.com/concourse/glider/store"
+	"github.com/concourse/glider/webhooks"
 )
 
-func New(logger lager.Logger, peerAddr, turbineURL string) (http.Handler, error) {
-	builds := handler.NewHandler(logger, peerAddr, turbineURL)
+// Config is everything the API is built from.
+type Config struct {
+	Logger lager.Logger
+
+	// address at which turbine reaches glider's callbacks
+	PeerAddr   string
+	TurbineURL string
+
+	Policy        policy.Policy
+	Quotas        quota.Quotas
+	Authenticator auth.Authenticator
+	RateLimits    ratelimit.Limits
+	Store         store.Store
+
+	// encrypts secret params at rest; nil leaves them in plaintext
+	Keyring *secrets.Keyring
+
+	Drainer  *drain.Drainer
+	Notifier *webhooks.Notifier
+
+	// build labels to break metrics down by, and their values to count
+	// separately
+	MetricLabels metrics.LabelValues
+
+	RecordHijacks bool
+
+	// 0 means no limit
+	MaxRecordingSize   int
+	MaxHijacksPerBuild int
+
+	// 0 disables each
+	HijackIdleTimeout time.Duration
+	HijackTimeout     time.Duration
+	KeepaliveInterval time.Duration
+}
+
+func New(config Config) (http.Handler, error) {
+	builds := handler.NewHandler(handler.Config{
+		Logger: config.Logger,
+
+		PeerAddr:   config.PeerAddr,
+		TurbineURL: config.TurbineURL,
+
+		Policy: config.Policy,
+		Quotas: config.Quotas,
+		Store:  config.Store,
+
+		Keyring: config.Keyring,
+
+		Drainer:  config.Drainer,
+		Notifier: config.Notifier,
+
+		MetricLabels: config.MetricLabels,
+
+		RecordHijacks: config.RecordHijacks,
+
+		MaxRecordingSize:   config.MaxRecordingSize,
+		MaxHijacksPerBuild: config.MaxHijacksPerBuild,
+
+		HijackIdleTimeout: config.HijackIdleTimeout,
+		HijackTimeout:     config.HijackTimeout,
+		KeepaliveInterval: config.KeepaliveInterval,
+	})
+
+	err := builds.Restore()
+	if err != nil {
+		return nil, err
+	}
+
+	config.Drainer.OnDrain(builds.DrainBuilds)
 
 	handlers := map[string]http.Handler{
-		routes.CreateBuild: http.HandlerFunc(builds.CreateBuild),
-		routes.GetBuilds:   http.HandlerFunc(builds.GetBuilds),
-		routes.HijackBuild: http.HandlerFunc(builds.HijackBuild),
-		routes.AbortBuild:  http.HandlerFunc(builds.AbortBuild),
+		routes.CreateBuild:   http.HandlerFunc(builds.CreateBuild),
+		routes.ValidateBuild: http.HandlerFunc(builds.ValidateBuild),
+		routes.GetBuilds:     http.HandlerFunc(builds.GetBuilds),
+		routes.HijackBuild:   http.HandlerFunc(builds.HijackBuild),
+		routes.AbortBuild:    http.HandlerFunc(builds.AbortBuild),
+
+		routes.AbortBuilds:  http.HandlerFunc(builds.AbortBuilds),
+		routes.DeleteBuilds: http.HandlerFunc(builds.DeleteBuilds),
+
+		routes.HijackBuildWebsocket: http.HandlerFunc(builds.HijackBuildWebsocket),
+
+		routes.GetHijacks:         http.HandlerFunc(builds.GetHijacks),
+		routes.GetHijackRecording: http.HandlerFunc(builds.GetHijackRecording),
+		routes.GetActiveHijacks:   http.HandlerFunc(builds.GetActiveHijacks),
+		routes.TerminateHijack:    http.HandlerFunc(builds.TerminateHijack),
 
 		routes.UploadBits:   http.HandlerFunc(builds.UploadBits),
 		routes.DownloadBits: http.HandlerFunc(builds.DownloadBits),
@@ -27,6 +116,56 @@ func New(logger lager.Logger, peerAddr, turbineURL string) (http.Handler, error)
 
 		routes.LogInput:  http.HandlerFunc(builds.LogInput),
 		routes.LogOutput: http.HandlerFunc(builds.LogOutput),
+
+		routes.GetDeliveries: http.HandlerFunc(builds.GetDeliveries),
+
+		routes.StreamEvents: http.HandlerFunc(builds.StreamEvents),
+
+		routes.GetQuotas: http.HandlerFunc(builds.GetQuotas),
+
+		routes.GetTemplates:   http.HandlerFunc(builds.GetTemplates),
+		routes.GetTemplate:    http.HandlerFunc(builds.GetTemplate),
+		routes.SaveTemplate:   http.HandlerFunc(builds.SaveTemplate),
+		routes.DeleteTemplate: http.HandlerFunc(builds.DeleteTemplate),
+
+		routes.Healthz: http.HandlerFunc(builds.Healthz),
+		routes.Readyz:  http.HandlerFunc(builds.Readyz),
+
+		routes.Drain: http.HandlerFunc(builds.Drain),
+	}
+
+	// failed authentications are throttled by IP, ahead of authentication,
+	// as the caller is not known until then
+	authenticator := config.Authenticator
+
+	var failures *ratelimit.Limiter
+	if limit, found := config.RateLimits[ratelimit.FailedAuthentication]; found {
+		failures = ratelimit.NewLimiter(limit)
+		authenticator = ratelimit.Authenticator(authenticator, failures)
+	}
+
+	for name, handler := range handlers {
+		// turbine's callbacks and probes are neither authenticated nor
+		// throttled
+		if routes.Callbacks[name] || routes.Probes[name] {
+			continue
+		}
+
+		if routes.Admin[name] {
+			handler = auth.RequireAdmin(handler)
+		}
+
+		if limit, found := config.RateLimits[name]; found {
+			handler = ratelimit.Handler(name, handler, ratelimit.NewLimiter(limit))
+		}
+
+		handler = auth.Handler(handler, authenticator)
+
+		if failures != nil {
+			handler = ratelimit.FailuresHandler(name, handler, failures)
+		}
+
+		handlers[name] = handler
 	}
 
 	return rata.NewRouter(routes.Routes, handlers)
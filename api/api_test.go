@@ -1,12 +1,18 @@
 package api_test
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -18,22 +24,109 @@ import (
 
 	"github.com/concourse/glider/api"
 	"github.com/concourse/glider/api/builds"
+	"github.com/concourse/glider/auth"
+	"github.com/concourse/glider/drain"
+	"github.com/concourse/glider/events"
+	"github.com/concourse/glider/metrics"
+	"github.com/concourse/glider/policy"
+	"github.com/concourse/glider/quota"
+	"github.com/concourse/glider/ratelimit"
+	"github.com/concourse/glider/routes"
+	"github.com/concourse/glider/secrets"
+	"github.com/concourse/glider/store"
+	"github.com/concourse/glider/webhooks"
 	TurbineBuilds "github.com/concourse/turbine/api/builds"
 )
 
 var _ = Describe("API", func() {
 	var turbineServer *ghttp.Server
 
+	var buildPolicy policy.Policy
+	var quotas quota.Quotas
+	var authenticator auth.Authenticator
+	var rateLimits ratelimit.Limits
+	var buildStore store.Store
+	var keyring *secrets.Keyring
+	var drainer *drain.Drainer
+	var notifier *webhooks.Notifier
+	var metricLabels metrics.LabelValues
+	var recordHijacks bool
+	var maxRecordingSize int
+	var maxHijacksPerBuild int
+	var hijackIdleTimeout time.Duration
+	var hijackTimeout time.Duration
+	var keepaliveInterval time.Duration
+
+	var logger *lagertest.TestLogger
 	var server *httptest.Server
 	var client *http.Client
 
-	BeforeEach(func() {
-		turbineServer = ghttp.NewServer()
+	config := func() api.Config {
+		return api.Config{
+			Logger: logger,
+
+			PeerAddr:   "peer-addr",
+			TurbineURL: turbineServer.URL(),
+
+			Policy:        buildPolicy,
+			Quotas:        quotas,
+			Authenticator: authenticator,
+			RateLimits:    rateLimits,
+			Store:         buildStore,
+
+			Keyring: keyring,
+
+			Drainer:  drainer,
+			Notifier: notifier,
+
+			MetricLabels: metricLabels,
+
+			RecordHijacks: recordHijacks,
 
-		handler, err := api.New(lagertest.NewTestLogger("test"), "peer-addr", turbineServer.URL())
+			MaxRecordingSize:   maxRecordingSize,
+			MaxHijacksPerBuild: maxHijacksPerBuild,
+
+			HijackIdleTimeout: hijackIdleTimeout,
+			HijackTimeout:     hijackTimeout,
+			KeepaliveInterval: keepaliveInterval,
+		}
+	}
+
+	serve := func() {
+		logger = lagertest.NewTestLogger("test")
+
+		handler, err := api.New(config())
 		Ω(err).ShouldNot(HaveOccurred())
 
 		server = httptest.NewServer(handler)
+	}
+
+	reserve := func() {
+		server.Close()
+		serve()
+	}
+
+	BeforeEach(func() {
+		turbineServer = ghttp.NewServer()
+
+		buildPolicy = policy.Policy{}
+		quotas = quota.Quotas{}
+		authenticator = auth.NoopAuthenticator{}
+		rateLimits = nil
+		buildStore = store.NewMemoryStore()
+		keyring = nil
+		drainer = drain.NewDrainer(time.Second)
+		notifier = webhooks.NewNotifier(lagertest.NewTestLogger("webhooks"), nil, "", 1, 0)
+		metricLabels = nil
+		recordHijacks = false
+		maxRecordingSize = 0
+		maxHijacksPerBuild = 0
+		hijackIdleTimeout = 0
+		hijackTimeout = 0
+		keepaliveInterval = 0
+
+		serve()
+
 		client = &http.Client{
 			Transport: &http.Transport{},
 		}
@@ -50,6 +143,16 @@ var _ = Describe("API", func() {
 		return string(payload)
 	}
 
+	decodeError := func(response *http.Response, details interface{}) builds.Error {
+		var errResponse builds.ErrorResponse
+		errResponse.Error.Details = details
+
+		err := json.NewDecoder(response.Body).Decode(&errResponse)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		return errResponse.Error
+	}
+
 	createBuild := func(build builds.Build) builds.Build {
 		response, err := client.Post(
 			server.URL+"/builds",
@@ -66,6 +169,27 @@ var _ = Describe("API", func() {
 		return build
 	}
 
+	// trigger uploads bits for the build, with turbine responding with the
+	// given build
+	trigger := func(guid string, turbineBuild TurbineBuilds.Build) {
+		turbineServer.AppendHandlers(
+			ghttp.CombineHandlers(
+				ghttp.VerifyRequest("POST", "/builds"),
+				ghttp.RespondWithJSONEncoded(201, turbineBuild),
+			),
+		)
+
+		go client.Get(server.URL + "/builds/" + guid + "/bits")
+
+		response, err := client.Post(
+			server.URL+"/builds/"+guid+"/bits",
+			"application/octet-stream",
+			bytes.NewBufferString("some-bits"),
+		)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(response.StatusCode).Should(Equal(http.StatusCreated))
+	}
+
 	Describe("POST /builds", func() {
 		var build *builds.Build
 		var requestBody string
@@ -101,6 +225,13 @@ var _ = Describe("API", func() {
 			Ω(response.StatusCode).Should(Equal(http.StatusCreated))
 		})
 
+		It("counts the build in the metrics", func() {
+			recorder := httptest.NewRecorder()
+			metrics.Handler().ServeHTTP(recorder, &http.Request{})
+
+			Ω(recorder.Body.String()).Should(MatchRegexp(`(?m)^glider_builds_created_total [1-9]`))
+		})
+
 		It("returns the build with an added guid and created_at", func() {
 			var returnedBuild builds.Build
 
@@ -115,6 +246,52 @@ var _ = Describe("API", func() {
 			Ω(returnedBuild.CreatedAt.UnixNano()).Should(BeNumerically("~", time.Now().UnixNano(), time.Second))
 		})
 
+		Context("when the payload carries a result", func() {
+			BeforeEach(func() {
+				exitStatus := 0
+
+				withResult := *build
+				withResult.Status = builds.StatusSucceeded
+				withResult.FinishedAt = time.Now()
+				withResult.ExitStatus = &exitStatus
+				withResult.Error = "some-error"
+
+				requestBody = buildPayload(&withResult)
+			})
+
+			It("ignores it", func() {
+				var returnedBuild builds.Build
+
+				err := json.NewDecoder(response.Body).Decode(&returnedBuild)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(returnedBuild.Status).Should(BeEmpty())
+				Ω(returnedBuild.FinishedAt.IsZero()).Should(BeTrue())
+				Ω(returnedBuild.ExitStatus).Should(BeNil())
+				Ω(returnedBuild.Error).Should(BeEmpty())
+			})
+		})
+
+		Context("when the payload says who aborted it", func() {
+			BeforeEach(func() {
+				aborted := *build
+				aborted.AbortedBy = "mallory"
+				aborted.AbortReason = "some-reason"
+
+				requestBody = buildPayload(&aborted)
+			})
+
+			It("ignores it", func() {
+				var returnedBuild builds.Build
+
+				err := json.NewDecoder(response.Body).Decode(&returnedBuild)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(returnedBuild.AbortedBy).Should(BeEmpty())
+				Ω(returnedBuild.AbortReason).Should(BeEmpty())
+			})
+		})
+
 		Context("when image is omitted", func() {
 			BeforeEach(func() {
 				build.Config.Image = ""
@@ -124,6 +301,170 @@ var _ = Describe("API", func() {
 			It("returns 400", func() {
 				Ω(response.StatusCode).Should(Equal(http.StatusBadRequest))
 			})
+
+			It("lists the missing image in the error details", func() {
+				var violations []policy.Violation
+				apiErr := decodeError(response, &violations)
+				Ω(apiErr.Code).Should(Equal(builds.ErrorInvalidBuild))
+				Ω(violations).Should(Equal([]policy.Violation{
+					{Rule: "image", Message: "missing build image"},
+				}))
+			})
+		})
+
+		Context("when the value of a secret param looks encrypted", func() {
+			BeforeEach(func() {
+				build.Config.Params = map[string]string{"TOKEN": "encrypted:not-really"}
+				build.SecretParams = []string{"TOKEN"}
+				requestBody = buildPayload(build)
+			})
+
+			It("returns 400, as it could not be told apart from a sealed value", func() {
+				Ω(response.StatusCode).Should(Equal(http.StatusBadRequest))
+
+				var violations []policy.Violation
+				apiErr := decodeError(response, &violations)
+				Ω(apiErr.Code).Should(Equal(builds.ErrorInvalidBuild))
+				Ω(violations).Should(Equal([]policy.Violation{
+					{Rule: "secret_params", Message: "value of secret param TOKEN may not look encrypted"},
+				}))
+			})
+		})
+
+		Context("when the build violates the policy", func() {
+			BeforeEach(func() {
+				buildPolicy = policy.Policy{
+					AllowedImages:  []string{"docker:///concourse/*"},
+					DeniedRunPaths: []string{"l*"},
+					MaxParamsSize:  4,
+				}
+
+				build.Config.Params = map[string]string{"FOO": "bar"}
+				requestBody = buildPayload(build)
+
+				reserve()
+			})
+
+			It("returns 403 with every violated rule", func() {
+				Ω(response.StatusCode).Should(Equal(http.StatusForbidden))
+
+				var violations []policy.Violation
+				apiErr := decodeError(response, &violations)
+				Ω(apiErr.Code).Should(Equal(builds.ErrorPolicyViolation))
+
+				Ω(violations).Should(HaveLen(3))
+				Ω(violations[0].Rule).Should(Equal(policy.RuleAllowedImages))
+				Ω(violations[1].Rule).Should(Equal(policy.RuleDeniedRunPaths))
+				Ω(violations[2].Rule).Should(Equal(policy.RuleMaxParamsSize))
+			})
+
+			Context("and the image is omitted", func() {
+				BeforeEach(func() {
+					build.Config.Image = ""
+					requestBody = buildPayload(build)
+				})
+
+				It("returns 400 listing the missing image along with the policy violations", func() {
+					Ω(response.StatusCode).Should(Equal(http.StatusBadRequest))
+
+					var violations []policy.Violation
+					apiErr := decodeError(response, &violations)
+					Ω(apiErr.Code).Should(Equal(builds.ErrorInvalidBuild))
+
+					Ω(violations).Should(HaveLen(4))
+					Ω(violations[0].Rule).Should(Equal("image"))
+				})
+			})
+		})
+
+		Context("when the build is privileged", func() {
+			BeforeEach(func() {
+				build.Privileged = true
+				requestBody = buildPayload(build)
+			})
+
+			Context("and privileged builds are not allowed", func() {
+				It("returns 403", func() {
+					Ω(response.StatusCode).Should(Equal(http.StatusForbidden))
+
+					var violations []policy.Violation
+					apiErr := decodeError(response, &violations)
+					Ω(apiErr.Code).Should(Equal(builds.ErrorPolicyViolation))
+
+					Ω(violations).Should(HaveLen(1))
+					Ω(violations[0].Rule).Should(Equal(policy.RulePrivileged))
+				})
+			})
+
+			Context("and privileged builds are allowed", func() {
+				BeforeEach(func() {
+					buildPolicy.Privileged.Allowed = true
+					reserve()
+				})
+
+				It("returns the build as privileged", func() {
+					Ω(response.StatusCode).Should(Equal(http.StatusCreated))
+
+					var returnedBuild builds.Build
+					err := json.NewDecoder(response.Body).Decode(&returnedBuild)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(returnedBuild.Privileged).Should(BeTrue())
+				})
+			})
+		})
+
+		Context("when privileged builds are limited to a team", func() {
+			BeforeEach(func() {
+				buildPolicy = policy.Policy{
+					Privileged: policy.PrivilegedPolicy{
+						Allowed: true,
+						Teams:   []string{"core"},
+					},
+				}
+
+				build.Privileged = true
+				requestBody = buildPayload(build)
+
+				authenticator = auth.NewBasicAuthenticator([]auth.User{
+					{Name: "alice", Password: "pass", Team: "core"},
+					{Name: "bob", Password: "pass", Team: "other"},
+				})
+
+				reserve()
+			})
+
+			createAs := func(user string) *http.Response {
+				req, err := http.NewRequest("POST", server.URL+"/builds", bytes.NewBufferString(requestBody))
+				Ω(err).ShouldNot(HaveOccurred())
+
+				req.SetBasicAuth(user, "pass")
+
+				response, err := client.Do(req)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				return response
+			}
+
+			It("returns 401 without credentials", func() {
+				Ω(response.StatusCode).Should(Equal(http.StatusUnauthorized))
+			})
+
+			It("allows members of the team", func() {
+				Ω(createAs("alice").StatusCode).Should(Equal(http.StatusCreated))
+			})
+
+			It("forbids everyone else", func() {
+				response := createAs("bob")
+				Ω(response.StatusCode).Should(Equal(http.StatusForbidden))
+
+				var violations []policy.Violation
+				apiErr := decodeError(response, &violations)
+				Ω(apiErr.Code).Should(Equal(builds.ErrorPolicyViolation))
+
+				Ω(violations).Should(HaveLen(1))
+				Ω(violations[0].Rule).Should(Equal(policy.RulePrivileged))
+			})
 		})
 
 		Context("when the payload is malformed JSON", func() {
@@ -134,6 +475,123 @@ var _ = Describe("API", func() {
 			It("returns 400", func() {
 				Ω(response.StatusCode).Should(Equal(http.StatusBadRequest))
 			})
+
+			It("describes the error", func() {
+				apiErr := decodeError(response, nil)
+				Ω(apiErr.Code).Should(Equal(builds.ErrorMalformedRequest))
+				Ω(apiErr.Message).Should(ContainSubstring("malformed build"))
+			})
+		})
+	})
+
+	Describe("POST /builds/validate", func() {
+		var contentType string
+		var requestBody string
+		var validation builds.Validation
+
+		BeforeEach(func() {
+			contentType = "application/json"
+		})
+
+		JustBeforeEach(func() {
+			response, err := client.Post(
+				server.URL+"/builds/validate",
+				contentType,
+				bytes.NewBufferString(requestBody),
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(response.StatusCode).Should(Equal(http.StatusOK))
+
+			validation = builds.Validation{}
+			err = json.NewDecoder(response.Body).Decode(&validation)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		Context("with a valid build", func() {
+			BeforeEach(func() {
+				requestBody = buildPayload(&builds.Build{
+					Config: TurbineBuilds.Config{Image: "ubuntu"},
+				})
+			})
+
+			It("reports it as valid", func() {
+				Ω(validation).Should(Equal(builds.Validation{
+					Valid:   true,
+					Invalid: []builds.Problem{},
+					Denied:  []builds.Problem{},
+				}))
+			})
+
+			It("does not create it", func() {
+				stored, err := buildStore.Builds()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(stored).Should(BeEmpty())
+			})
+		})
+
+		Context("with a build that is invalid and violates the policy", func() {
+			BeforeEach(func() {
+				buildPolicy = policy.Policy{
+					DeniedRunPaths: []string{"rm"},
+				}
+				reserve()
+
+				requestBody = buildPayload(&builds.Build{
+					Config: TurbineBuilds.Config{
+						Run: TurbineBuilds.RunConfig{Path: "rm"},
+					},
+					Notify: []string{"ftp://example.com"},
+				})
+			})
+
+			It("reports every problem at once", func() {
+				Ω(validation.Valid).Should(BeFalse())
+				Ω(validation.Invalid).Should(Equal([]builds.Problem{
+					{Rule: "image", Message: "missing build image"},
+					{Rule: "notify", Message: "invalid notify url: ftp://example.com"},
+				}))
+				Ω(validation.Denied).Should(HaveLen(1))
+				Ω(validation.Denied[0].Rule).Should(Equal(policy.RuleDeniedRunPaths))
+			})
+		})
+
+		Context("with a build.yml", func() {
+			BeforeEach(func() {
+				contentType = "application/x-yaml"
+				requestBody = "image: ubuntu\nparms:\n  FOO: bar\nrun:\n  path: ls\n"
+			})
+
+			It("reports fields turbine does not know about", func() {
+				Ω(validation.Valid).Should(BeFalse())
+				Ω(validation.Invalid).Should(HaveLen(1))
+				Ω(validation.Invalid[0].Rule).Should(Equal("config"))
+				Ω(validation.Invalid[0].Message).Should(ContainSubstring("parms"))
+			})
+
+			Context("when it is valid", func() {
+				BeforeEach(func() {
+					requestBody = "image: ubuntu\nparams:\n  FOO: bar\nrun:\n  path: ls\n"
+				})
+
+				It("reports it as valid", func() {
+					Ω(validation.Valid).Should(BeTrue())
+				})
+			})
+		})
+	})
+
+	Describe("POST /builds/validate with a malformed body", func() {
+		It("returns 400", func() {
+			response, err := client.Post(
+				server.URL+"/builds/validate",
+				"application/x-yaml",
+				bytes.NewBufferString("image: [ubuntu"),
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(response.StatusCode).Should(Equal(http.StatusBadRequest))
+
+			apiErr := decodeError(response, nil)
+			Ω(apiErr.Code).Should(Equal(builds.ErrorMalformedRequest))
 		})
 	})
 
@@ -185,362 +643,3395 @@ var _ = Describe("API", func() {
 		})
 	})
 
-	Describe("POST /builds/:guid/bits", func() {
-		var build builds.Build
+	Describe("GET /builds with filters", func() {
+		var pending builds.Build
+		var aborted builds.Build
+		var other builds.Build
 
-		var response *http.Response
+		getBuilds := func(query string) []builds.Build {
+			response, err := client.Get(server.URL + "/builds?" + query)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(response.StatusCode).Should(Equal(http.StatusOK))
 
-		BeforeEach(func() {
-			build = builds.Build{
-				Guid: "some-guid",
+			var returnedBuilds []builds.Build
+			err = json.NewDecoder(response.Body).Decode(&returnedBuilds)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			return returnedBuilds
+		}
+
+		guids := func(returnedBuilds []builds.Build) []string {
+			guids := []string{}
+			for _, build := range returnedBuilds {
+				guids = append(guids, build.Guid)
 			}
-		})
 
-		JustBeforeEach(func() {
-			var err error
+			return guids
+		}
 
-			// set up a consumer
-			go client.Get(server.URL + "/builds/" + build.Guid + "/bits")
+		BeforeEach(func() {
+			pending = createBuild(builds.Build{
+				Name:   "runaway",
+				Config: TurbineBuilds.Config{Image: "ubuntu"},
+				Labels: map[string]string{"purpose": "smoke", "branch": "main"},
+			})
+			aborted = createBuild(builds.Build{
+				Name:   "runaway",
+				Config: TurbineBuilds.Config{Image: "busybox"},
+				Labels: map[string]string{"purpose": "smoke", "branch": "feature/x"},
+			})
+			other = createBuild(builds.Build{Name: "other", Config: TurbineBuilds.Config{Image: "ubuntu"}})
 
-			response, err = client.Post(
-				server.URL+"/builds/"+build.Guid+"/bits",
-				"application/octet-stream",
-				bytes.NewBufferString("streamed body"),
-			)
+			response, err := client.Post(server.URL+"/builds/"+aborted.Guid+"/abort", "application/json", nil)
 			Ω(err).ShouldNot(HaveOccurred())
+			Ω(response.StatusCode).Should(Equal(http.StatusOK))
 		})
 
-		Context("with a valid build guid", func() {
-			BeforeEach(func() {
-				build = createBuild(builds.Build{
-					Name: "some-name",
-					Config: TurbineBuilds.Config{
-						Image: "ubuntu",
-						Params: map[string]string{
-							"FOO": "bar",
-						},
-						Run: TurbineBuilds.RunConfig{
-							Path: "ls",
-							Args: []string{"-al", "/"},
-						},
-					},
-				})
-			})
+		It("filters by status, with pending matching builds without one", func() {
+			Ω(guids(getBuilds("status=pending"))).Should(Equal([]string{other.Guid, pending.Guid}))
+			Ω(guids(getBuilds("status=aborted"))).Should(Equal([]string{aborted.Guid}))
+			Ω(guids(getBuilds("status=aborted,pending"))).Should(HaveLen(3))
+		})
 
-			BeforeEach(func() {
-				turbineBuild := TurbineBuilds.Build{
-					Guid: build.Guid,
+		It("filters by name", func() {
+			Ω(guids(getBuilds("name=runaway"))).Should(Equal([]string{aborted.Guid, pending.Guid}))
+		})
 
-					Privileged: true,
+		It("filters by image", func() {
+			Ω(guids(getBuilds("image=ubuntu"))).Should(Equal([]string{other.Guid, pending.Guid}))
+		})
 
-					Config: TurbineBuilds.Config{
-						Image: "ubuntu",
-						Params: map[string]string{
-							"FOO": "bar",
-						},
-						Run: TurbineBuilds.RunConfig{
-							Path: "ls",
-							Args: []string{"-al", "/"},
-						},
-					},
+		It("filters by labels, requiring every one to match", func() {
+			Ω(guids(getBuilds("labels=purpose=smoke"))).Should(Equal([]string{aborted.Guid, pending.Guid}))
+			Ω(guids(getBuilds("labels=purpose=smoke,branch=feature/x"))).Should(Equal([]string{aborted.Guid}))
+			Ω(getBuilds("labels=purpose=deploy")).Should(BeEmpty())
+		})
 
-					Inputs: []TurbineBuilds.Input{
-						{
-							Name: "some-name",
-							Type: "archive",
-							Source: TurbineBuilds.Source{
-								"uri": "http://peer-addr/builds/" + build.Guid + "/bits",
-							},
+		It("filters by age", func() {
+			Ω(getBuilds("older_than=1h")).Should(BeEmpty())
+			Ω(getBuilds("older_than=0s")).Should(HaveLen(3))
+		})
+
+		It("combines filters", func() {
+			Ω(guids(getBuilds("name=runaway&image=ubuntu&status=pending"))).Should(Equal([]string{pending.Guid}))
+		})
+
+		Context("with an unknown status", func() {
+			It("returns 400", func() {
+				response, err := client.Get(server.URL + "/builds?status=bogus")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(response.StatusCode).Should(Equal(http.StatusBadRequest))
+
+				Ω(decodeError(response, nil).Code).Should(Equal(builds.ErrorMalformedRequest))
+			})
+		})
+
+		Context("with a malformed age", func() {
+			It("returns 400", func() {
+				response, err := client.Get(server.URL + "/builds?older_than=yesterday")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(response.StatusCode).Should(Equal(http.StatusBadRequest))
+
+				Ω(decodeError(response, nil).Code).Should(Equal(builds.ErrorMalformedRequest))
+			})
+		})
+
+		Context("with a malformed label selector", func() {
+			It("returns 400", func() {
+				response, err := client.Get(server.URL + "/builds?labels=purpose")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(response.StatusCode).Should(Equal(http.StatusBadRequest))
+
+				Ω(decodeError(response, nil).Code).Should(Equal(builds.ErrorMalformedRequest))
+			})
+		})
+	})
+
+	Describe("labels", func() {
+		It("returns them with the build", func() {
+			build := createBuild(builds.Build{
+				Config: TurbineBuilds.Config{Image: "ubuntu"},
+				Labels: map[string]string{"ticket": "OPS-123"},
+			})
+
+			Ω(build.Labels).Should(Equal(map[string]string{"ticket": "OPS-123"}))
+		})
+
+		It("rejects labels that could not be selected by", func() {
+			build := builds.Build{
+				Config: TurbineBuilds.Config{Image: "ubuntu"},
+				Labels: map[string]string{"a=b": "c", "branch": "x,y"},
+			}
+
+			response, err := client.Post(
+				server.URL+"/builds",
+				"application/json",
+				bytes.NewBufferString(buildPayload(&build)),
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(response.StatusCode).Should(Equal(http.StatusBadRequest))
+
+			var violations []policy.Violation
+			decodeError(response, &violations)
+			Ω(violations).Should(Equal([]policy.Violation{
+				{Rule: "labels", Message: "invalid label key: a=b"},
+				{Rule: "labels", Message: "value of label branch may not contain ',' or '='"},
+			}))
+		})
+
+		Context("when configured to break metrics down by a label", func() {
+			BeforeEach(func() {
+				metricLabels = metrics.LabelValues{"purpose": {"label-metrics"}}
+				reserve()
+			})
+
+			It("counts builds by its values", func() {
+				build := createBuild(builds.Build{
+					Config: TurbineBuilds.Config{Image: "ubuntu"},
+					Labels: map[string]string{"purpose": "label-metrics", "ticket": "OPS-123"},
+				})
+
+				response, err := client.Post(server.URL+"/builds/"+build.Guid+"/abort", "application/json", nil)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(response.StatusCode).Should(Equal(http.StatusOK))
+
+				recorder := httptest.NewRecorder()
+				metrics.Handler().ServeHTTP(recorder, &http.Request{})
+
+				body := recorder.Body.String()
+				Ω(body).Should(ContainSubstring(`glider_labelled_builds_created_total{label="purpose",value="label-metrics"} 1`))
+				Ω(body).Should(ContainSubstring(`glider_labelled_build_statuses_total{label="purpose",value="label-metrics",status="aborted"} 1`))
+				Ω(body).ShouldNot(ContainSubstring("OPS-123"))
+			})
+
+			It("counts values that are not listed as other", func() {
+				createBuild(builds.Build{
+					Config: TurbineBuilds.Config{Image: "ubuntu"},
+					Labels: map[string]string{"purpose": "unlisted-purpose"},
+				})
+
+				recorder := httptest.NewRecorder()
+				metrics.Handler().ServeHTTP(recorder, &http.Request{})
+
+				body := recorder.Body.String()
+				Ω(body).Should(ContainSubstring(`glider_labelled_builds_created_total{label="purpose",value="other"}`))
+				Ω(body).ShouldNot(ContainSubstring("unlisted-purpose"))
+			})
+		})
+	})
+
+	Describe("bulk operations", func() {
+		var runaways []builds.Build
+		var other builds.Build
+
+		bulk := func(method string, query string) []builds.BulkResult {
+			request, err := http.NewRequest(method, server.URL+"/builds"+query, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			response, err := client.Do(request)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(response.StatusCode).Should(Equal(http.StatusOK))
+
+			var results []builds.BulkResult
+			err = json.NewDecoder(response.Body).Decode(&results)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			return results
+		}
+
+		getBuilds := func() []builds.Build {
+			response, err := client.Get(server.URL + "/builds")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			var returnedBuilds []builds.Build
+			err = json.NewDecoder(response.Body).Decode(&returnedBuilds)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			return returnedBuilds
+		}
+
+		BeforeEach(func() {
+			runaways = []builds.Build{
+				createBuild(builds.Build{Name: "runaway", Config: TurbineBuilds.Config{Image: "ubuntu"}, Labels: map[string]string{"purpose": "smoke"}}),
+				createBuild(builds.Build{Name: "runaway", Config: TurbineBuilds.Config{Image: "ubuntu"}, Labels: map[string]string{"purpose": "smoke"}}),
+			}
+
+			other = createBuild(builds.Build{Name: "other", Config: TurbineBuilds.Config{Image: "ubuntu"}})
+		})
+
+		Describe("POST /builds/abort", func() {
+			It("aborts every matching build, reporting each", func() {
+				results := bulk("POST", "/abort?name=runaway")
+				Ω(results).Should(Equal([]builds.BulkResult{
+					{Guid: runaways[1].Guid, Name: "runaway", Status: builds.StatusAborted},
+					{Guid: runaways[0].Guid, Name: "runaway", Status: builds.StatusAborted},
+				}))
+
+				for _, build := range getBuilds() {
+					if build.Guid == other.Guid {
+						Ω(build.Status).Should(BeEmpty())
+					} else {
+						Ω(build.Status).Should(Equal(builds.StatusAborted))
+					}
+				}
+			})
+
+			It("selects builds by label", func() {
+				results := bulk("POST", "/abort?labels=purpose=smoke")
+				Ω(results).Should(HaveLen(2))
+				Ω(results[0].Guid).Should(Equal(runaways[1].Guid))
+				Ω(results[1].Guid).Should(Equal(runaways[0].Guid))
+			})
+
+			It("reports builds that have already finished", func() {
+				bulk("POST", "/abort?name=runaway")
+
+				results := bulk("POST", "/abort?name=runaway")
+				Ω(results).Should(HaveLen(2))
+
+				for _, result := range results {
+					Ω(result.Error).ShouldNot(BeNil())
+					Ω(result.Error.Code).Should(Equal(builds.ErrorBuildFinished))
+				}
+			})
+
+			Context("in a dry run", func() {
+				It("reports what would be aborted without aborting it", func() {
+					results := bulk("POST", "/abort?name=runaway&dry_run=true")
+					Ω(results).Should(Equal([]builds.BulkResult{
+						{Guid: runaways[1].Guid, Name: "runaway"},
+						{Guid: runaways[0].Guid, Name: "runaway"},
+					}))
+
+					for _, build := range getBuilds() {
+						Ω(build.Status).Should(BeEmpty())
+					}
+				})
+			})
+		})
+
+		Describe("DELETE /builds", func() {
+			var reaped <-chan events.Event
+
+			BeforeEach(func() {
+				bulk("POST", "/abort?name=runaway")
+
+				conn, _, err := websocket.DefaultDialer.Dial("ws://"+server.Listener.Addr().String()+"/events", nil)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				received := make(chan events.Event, 10)
+				go func() {
+					defer GinkgoRecover()
+					defer close(received)
+
+					for {
+						var event events.Event
+						err := conn.ReadJSON(&event)
+						if err != nil {
+							return
+						}
+
+						if event.Type == events.Reaped {
+							received <- event
+						}
+					}
+				}()
+
+				reaped = received
+			})
+
+			It("deletes every matching finished build, reporting each", func() {
+				results := bulk("DELETE", "?image=ubuntu")
+				Ω(results).Should(HaveLen(3))
+
+				Ω(results[0].Guid).Should(Equal(other.Guid))
+				Ω(results[0].Error).ShouldNot(BeNil())
+				Ω(results[0].Error.Code).Should(Equal(builds.ErrorBuildNotFinished))
+
+				Ω(results[1]).Should(Equal(builds.BulkResult{Guid: runaways[1].Guid, Name: "runaway", Status: builds.StatusAborted}))
+				Ω(results[2]).Should(Equal(builds.BulkResult{Guid: runaways[0].Guid, Name: "runaway", Status: builds.StatusAborted}))
+
+				remaining := getBuilds()
+				Ω(remaining).Should(HaveLen(1))
+				Ω(remaining[0].Guid).Should(Equal(other.Guid))
+			})
+
+			It("removes them from the store", func() {
+				bulk("DELETE", "?name=runaway")
+
+				stored, err := buildStore.Builds()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(stored).Should(HaveLen(1))
+				Ω(stored[0].Guid).Should(Equal(other.Guid))
+			})
+
+			It("emits a reaped event for each", func() {
+				bulk("DELETE", "?name=runaway")
+
+				Eventually(reaped).Should(Receive())
+				Eventually(reaped).Should(Receive())
+			})
+
+			It("forgets their logs", func() {
+				bulk("DELETE", "?name=runaway")
+
+				_, response, err := websocket.DefaultDialer.Dial(
+					fmt.Sprintf("ws://%s/builds/%s/log/output", server.Listener.Addr().String(), runaways[0].Guid),
+					nil,
+				)
+				Ω(err).Should(HaveOccurred())
+				Ω(response.StatusCode).Should(Equal(http.StatusNotFound))
+			})
+
+			Context("in a dry run", func() {
+				It("reports what would be deleted without deleting it", func() {
+					results := bulk("DELETE", "?name=runaway&dry_run=true")
+					Ω(results).Should(HaveLen(2))
+
+					for _, result := range results {
+						Ω(result.Error).Should(BeNil())
+					}
+
+					Ω(getBuilds()).Should(HaveLen(3))
+					Consistently(reaped).ShouldNot(Receive())
+				})
+			})
+		})
+
+		Context("without any filters", func() {
+			It("refuses to touch every build", func() {
+				request, err := http.NewRequest("DELETE", server.URL+"/builds", nil)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				response, err := client.Do(request)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(response.StatusCode).Should(Equal(http.StatusBadRequest))
+
+				Ω(decodeError(response, nil).Code).Should(Equal(builds.ErrorMalformedRequest))
+			})
+		})
+	})
+
+	Describe("teams", func() {
+		var aliceBuild builds.Build
+		var bobBuild builds.Build
+
+		as := func(user string) {
+			client.Transport = basicAuthTransport(user, "pass")
+		}
+
+		getBuilds := func(query string) []builds.Build {
+			response, err := client.Get(server.URL + "/builds" + query)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(response.StatusCode).Should(Equal(http.StatusOK))
+
+			var returnedBuilds []builds.Build
+			err = json.NewDecoder(response.Body).Decode(&returnedBuilds)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			return returnedBuilds
+		}
+
+		BeforeEach(func() {
+			authenticator = auth.NewBasicAuthenticator([]auth.User{
+				{Name: "alice", Password: "pass", Team: "team-a"},
+				{Name: "bob", Password: "pass", Team: "team-b"},
+				{Name: "carol", Password: "pass", Team: "ops", Admin: true},
+			})
+
+			reserve()
+
+			as("alice")
+			aliceBuild = createBuild(builds.Build{Config: TurbineBuilds.Config{Image: "ubuntu"}})
+
+			as("bob")
+			bobBuild = createBuild(builds.Build{Config: TurbineBuilds.Config{Image: "ubuntu"}})
+		})
+
+		It("records the team and user that created the build", func() {
+			Ω(aliceBuild.Team).Should(Equal("team-a"))
+			Ω(aliceBuild.CreatedBy).Should(Equal("alice"))
+		})
+
+		It("ignores any team given in the payload", func() {
+			as("alice")
+
+			build := createBuild(builds.Build{Team: "team-b", Config: TurbineBuilds.Config{Image: "ubuntu"}})
+			Ω(build.Team).Should(Equal("team-a"))
+		})
+
+		It("only lists the caller's team's builds", func() {
+			as("alice")
+
+			listed := getBuilds("")
+			Ω(listed).Should(HaveLen(1))
+			Ω(listed[0].Guid).Should(Equal(aliceBuild.Guid))
+		})
+
+		It("hides other teams' builds", func() {
+			as("bob")
+
+			for _, path := range []string{"/result", "/hijacks", "/deliveries"} {
+				response, err := client.Get(server.URL + "/builds/" + aliceBuild.Guid + path)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(response.StatusCode).Should(Equal(http.StatusNotFound), path)
+			}
+
+			for _, path := range []string{"/abort", "/hijack", "/bits"} {
+				response, err := client.Post(server.URL+"/builds/"+aliceBuild.Guid+path, "application/json", nil)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(response.StatusCode).Should(Equal(http.StatusNotFound), path)
+			}
+
+			_, response, err := websocket.DefaultDialer.Dial(
+				fmt.Sprintf("ws://%s/builds/%s/log/output", server.Listener.Addr().String(), aliceBuild.Guid),
+				http.Header{"Authorization": {"Basic Ym9iOnBhc3M="}},
+			)
+			Ω(err).Should(HaveOccurred())
+			Ω(response.StatusCode).Should(Equal(http.StatusNotFound))
+		})
+
+		It("limits bulk operations to the caller's team's builds", func() {
+			as("bob")
+
+			request, err := http.NewRequest("POST", server.URL+"/builds/abort?status=pending", nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			response, err := client.Do(request)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			var results []builds.BulkResult
+			err = json.NewDecoder(response.Body).Decode(&results)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(results).Should(HaveLen(1))
+			Ω(results[0].Guid).Should(Equal(bobBuild.Guid))
+		})
+
+		It("only streams events for the caller's team's builds", func() {
+			conn, _, err := websocket.DefaultDialer.Dial(
+				"ws://"+server.Listener.Addr().String()+"/events",
+				http.Header{"Authorization": {"Basic Ym9iOnBhc3M="}},
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			defer conn.Close()
+
+			as("alice")
+			createBuild(builds.Build{Config: TurbineBuilds.Config{Image: "ubuntu"}})
+
+			as("bob")
+			created := createBuild(builds.Build{Config: TurbineBuilds.Config{Image: "ubuntu"}})
+
+			var event events.Event
+			err = conn.ReadJSON(&event)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(event.Build.Guid).Should(Equal(created.Guid))
+		})
+
+		Context("as an admin", func() {
+			BeforeEach(func() {
+				as("carol")
+			})
+
+			It("lists every team's builds", func() {
+				Ω(getBuilds("")).Should(HaveLen(2))
+			})
+
+			It("can filter by team", func() {
+				listed := getBuilds("?team=team-a")
+				Ω(listed).Should(HaveLen(1))
+				Ω(listed[0].Guid).Should(Equal(aliceBuild.Guid))
+			})
+
+			It("can act on any team's builds", func() {
+				response, err := client.Post(server.URL+"/builds/"+aliceBuild.Guid+"/abort", "application/json", nil)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(response.StatusCode).Should(Equal(http.StatusOK))
+			})
+		})
+	})
+
+	Describe("quotas", func() {
+		as := func(user string) {
+			client.Transport = basicAuthTransport(user, "pass")
+		}
+
+		postBuild := func() *http.Response {
+			response, err := client.Post(
+				server.URL+"/builds",
+				"application/json",
+				bytes.NewBufferString(`{"config":{"image":"ubuntu"}}`),
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			return response
+		}
+
+		getQuotas := func() builds.Quotas {
+			response, err := client.Get(server.URL + "/quotas")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(response.StatusCode).Should(Equal(http.StatusOK))
+
+			var quotas builds.Quotas
+			err = json.NewDecoder(response.Body).Decode(&quotas)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			return quotas
+		}
+
+		BeforeEach(func() {
+			authenticator = auth.NewBasicAuthenticator([]auth.User{
+				{Name: "alice", Password: "pass", Team: "team-a"},
+				{Name: "bob", Password: "pass", Team: "team-a"},
+				{Name: "carol", Password: "pass", Team: "team-c"},
+			})
+
+			as("alice")
+		})
+
+		Context("with a limit on concurrent builds", func() {
+			BeforeEach(func() {
+				quotas.Users = map[string]builds.QuotaLimits{
+					"alice": {ConcurrentBuilds: 1},
+				}
+
+				reserve()
+			})
+
+			It("refuses builds beyond it with 429 and a Retry-After", func() {
+				Ω(postBuild().StatusCode).Should(Equal(http.StatusCreated))
+
+				response := postBuild()
+				Ω(response.StatusCode).Should(Equal(http.StatusTooManyRequests))
+				Ω(response.Header.Get("Retry-After")).Should(Equal("60"))
+
+				var details builds.QuotaDetails
+				Ω(decodeError(response, &details).Code).Should(Equal(builds.ErrorQuotaExceeded))
+				Ω(details).Should(Equal(builds.QuotaDetails{
+					Scope: "user",
+					Name:  "alice",
+					Quota: "concurrent_builds",
+					Limit: 1,
+				}))
+			})
+
+			It("admits another build once one finishes", func() {
+				var build builds.Build
+				err := json.NewDecoder(postBuild().Body).Decode(&build)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				response, err := client.Post(server.URL+"/builds/"+build.Guid+"/abort", "application/json", nil)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(response.StatusCode).Should(Equal(http.StatusOK))
+
+				Ω(postBuild().StatusCode).Should(Equal(http.StatusCreated))
+			})
+
+			It("does not limit other users", func() {
+				Ω(postBuild().StatusCode).Should(Equal(http.StatusCreated))
+
+				as("bob")
+				Ω(postBuild().StatusCode).Should(Equal(http.StatusCreated))
+			})
+		})
+
+		Context("with a limit on builds per hour for the team", func() {
+			BeforeEach(func() {
+				quotas.Teams = map[string]builds.QuotaLimits{
+					"team-a": {BuildsPerHour: 2},
+				}
+
+				reserve()
+			})
+
+			It("counts builds by everyone on the team, until the oldest is an hour old", func() {
+				Ω(postBuild().StatusCode).Should(Equal(http.StatusCreated))
+
+				as("bob")
+				Ω(postBuild().StatusCode).Should(Equal(http.StatusCreated))
+
+				response := postBuild()
+				Ω(response.StatusCode).Should(Equal(http.StatusTooManyRequests))
+
+				retryAfter, err := strconv.Atoi(response.Header.Get("Retry-After"))
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(retryAfter).Should(BeNumerically("~", 3600, 5))
+
+				var details builds.QuotaDetails
+				decodeError(response, &details)
+				Ω(details.Scope).Should(Equal("team"))
+				Ω(details.Quota).Should(Equal("builds_per_hour"))
+			})
+
+			It("keeps counting builds that have been deleted", func() {
+				Ω(postBuild().StatusCode).Should(Equal(http.StatusCreated))
+				Ω(postBuild().StatusCode).Should(Equal(http.StatusCreated))
+
+				response, err := client.Post(server.URL+"/builds/abort?image=ubuntu", "application/json", nil)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(response.StatusCode).Should(Equal(http.StatusOK))
+
+				request, err := http.NewRequest("DELETE", server.URL+"/builds?image=ubuntu", nil)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				response, err = client.Do(request)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(response.StatusCode).Should(Equal(http.StatusOK))
+				Ω(getQuotas().Team.Usage.ConcurrentBuilds).Should(BeZero())
+
+				Ω(postBuild().StatusCode).Should(Equal(http.StatusTooManyRequests))
+			})
+
+			It("does not limit other teams", func() {
+				as("carol")
+
+				for i := 0; i < 3; i++ {
+					Ω(postBuild().StatusCode).Should(Equal(http.StatusCreated))
+				}
+			})
+		})
+
+		Context("with limits for any team", func() {
+			BeforeEach(func() {
+				quotas.Teams = map[string]builds.QuotaLimits{
+					"team-a": {ConcurrentBuilds: 2},
+					"*":      {ConcurrentBuilds: 1},
+				}
+
+				reserve()
+			})
+
+			It("applies them to teams that are not listed", func() {
+				as("carol")
+
+				Ω(postBuild().StatusCode).Should(Equal(http.StatusCreated))
+				Ω(postBuild().StatusCode).Should(Equal(http.StatusTooManyRequests))
+
+				as("alice")
+
+				Ω(postBuild().StatusCode).Should(Equal(http.StatusCreated))
+				Ω(postBuild().StatusCode).Should(Equal(http.StatusCreated))
+			})
+		})
+
+		Context("with a limit on bits size", func() {
+			BeforeEach(func() {
+				quotas.Users = map[string]builds.QuotaLimits{
+					"alice": {MaxBitsSize: 4},
+				}
+
+				reserve()
+			})
+
+			It("refuses larger bits with 413", func() {
+				build := createBuild(builds.Build{Config: TurbineBuilds.Config{Image: "ubuntu"}})
+
+				response, err := client.Post(
+					server.URL+"/builds/"+build.Guid+"/bits",
+					"application/octet-stream",
+					bytes.NewBufferString("some-bits"),
+				)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(response.StatusCode).Should(Equal(http.StatusRequestEntityTooLarge))
+
+				var details builds.QuotaDetails
+				Ω(decodeError(response, &details).Code).Should(Equal(builds.ErrorQuotaExceeded))
+				Ω(details.Quota).Should(Equal("max_bits_size"))
+
+				Ω(turbineServer.ReceivedRequests()).Should(BeEmpty())
+			})
+
+			It("refuses bits of unknown length with 411", func() {
+				build := createBuild(builds.Build{Config: TurbineBuilds.Config{Image: "ubuntu"}})
+
+				// hide the buffer's length, so that the bits are sent chunked
+				bits := struct{ io.Reader }{bytes.NewBufferString("bits")}
+
+				response, err := client.Post(
+					server.URL+"/builds/"+build.Guid+"/bits",
+					"application/octet-stream",
+					bits,
+				)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(response.StatusCode).Should(Equal(http.StatusLengthRequired))
+
+				var details builds.QuotaDetails
+				Ω(decodeError(response, &details).Code).Should(Equal(builds.ErrorQuotaExceeded))
+				Ω(details.Quota).Should(Equal("max_bits_size"))
+
+				Ω(turbineServer.ReceivedRequests()).Should(BeEmpty())
+			})
+		})
+
+		Context("with a limit on log bytes", func() {
+			BeforeEach(func() {
+				quotas.Teams = map[string]builds.QuotaLimits{
+					"team-a": {LogBytes: 10},
+				}
+
+				reserve()
+			})
+
+			It("refuses builds once the team's logs reach it", func() {
+				build := createBuild(builds.Build{Config: TurbineBuilds.Config{Image: "ubuntu"}})
+
+				conn, _, err := websocket.DefaultDialer.Dial(
+					fmt.Sprintf("ws://%s/builds/%s/log/input", server.Listener.Addr().String(), build.Guid),
+					nil,
+				)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				defer conn.Close()
+
+				err = conn.WriteJSON("a fairly long log line")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Eventually(func() int {
+					return postBuild().StatusCode
+				}).Should(Equal(http.StatusTooManyRequests))
+			})
+		})
+
+		Describe("GET /quotas", func() {
+			BeforeEach(func() {
+				quotas.Users = map[string]builds.QuotaLimits{
+					"alice": {ConcurrentBuilds: 5},
+				}
+
+				quotas.Teams = map[string]builds.QuotaLimits{
+					"team-a": {BuildsPerHour: 10, LogBytes: 1024},
+				}
+
+				reserve()
+
+				createBuild(builds.Build{Config: TurbineBuilds.Config{Image: "ubuntu"}})
+
+				as("bob")
+				createBuild(builds.Build{Config: TurbineBuilds.Config{Image: "ubuntu"}})
+
+				as("alice")
+			})
+
+			It("shows the limits and usage of the caller and their team", func() {
+				Ω(getQuotas()).Should(Equal(builds.Quotas{
+					User: builds.Quota{
+						Name:   "alice",
+						Limits: builds.QuotaLimits{ConcurrentBuilds: 5},
+						Usage:  builds.QuotaUsage{ConcurrentBuilds: 1, BuildsLastHour: 1},
+					},
+					Team: builds.Quota{
+						Name:   "team-a",
+						Limits: builds.QuotaLimits{BuildsPerHour: 10, LogBytes: 1024},
+						Usage:  builds.QuotaUsage{ConcurrentBuilds: 2, BuildsLastHour: 2},
+					},
+				}))
+			})
+		})
+	})
+
+	Describe("rate limiting", func() {
+		BeforeEach(func() {
+			rateLimits = ratelimit.Limits{
+				routes.CreateBuild: {Rate: 0.1, Burst: 2},
+				routes.SetResult:   {Rate: 0.1, Burst: 1},
+			}
+
+			reserve()
+		})
+
+		It("refuses requests to a limited route beyond its burst", func() {
+			createBuild(builds.Build{Config: TurbineBuilds.Config{Image: "ubuntu"}})
+			createBuild(builds.Build{Config: TurbineBuilds.Config{Image: "ubuntu"}})
+
+			response, err := client.Post(
+				server.URL+"/builds",
+				"application/json",
+				bytes.NewBufferString(`{"config":{"image":"ubuntu"}}`),
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(response.StatusCode).Should(Equal(http.StatusTooManyRequests))
+			Ω(response.Header.Get("Retry-After")).Should(Equal("10"))
+
+			Ω(decodeError(response, nil).Code).Should(Equal(builds.ErrorRateLimited))
+		})
+
+		It("does not limit other routes", func() {
+			for i := 0; i < 5; i++ {
+				response, err := client.Get(server.URL + "/builds")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(response.StatusCode).Should(Equal(http.StatusOK))
+			}
+		})
+
+		It("never limits turbine's callbacks", func() {
+			build := createBuild(builds.Build{Config: TurbineBuilds.Config{Image: "ubuntu"}})
+
+			for i := 0; i < 3; i++ {
+				request, err := http.NewRequest("PUT", server.URL+"/builds/"+build.Guid+"/result", bytes.NewBufferString(`{"status":"started"}`))
+				Ω(err).ShouldNot(HaveOccurred())
+
+				response, err := client.Do(request)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(response.StatusCode).Should(Equal(http.StatusOK))
+			}
+		})
+
+		Context("with a limit on failed authentications", func() {
+			BeforeEach(func() {
+				authenticator = auth.NewBasicAuthenticator([]auth.User{
+					{Name: "alice", Password: "pass", Team: "team-a"},
+				})
+
+				rateLimits = ratelimit.Limits{
+					ratelimit.FailedAuthentication: {Rate: 0.1, Burst: 2},
+				}
+
+				reserve()
+			})
+
+			getBuilds := func(password string) *http.Response {
+				client.Transport = basicAuthTransport("alice", password)
+
+				response, err := client.Get(server.URL + "/builds")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				return response
+			}
+
+			It("refuses every request from the IP once it runs out, even with the right password", func() {
+				Ω(getBuilds("pass").StatusCode).Should(Equal(http.StatusOK))
+
+				Ω(getBuilds("guess-1").StatusCode).Should(Equal(http.StatusUnauthorized))
+				Ω(getBuilds("guess-2").StatusCode).Should(Equal(http.StatusUnauthorized))
+
+				response := getBuilds("guess-3")
+				Ω(response.StatusCode).Should(Equal(http.StatusTooManyRequests))
+				Ω(response.Header.Get("Retry-After")).Should(Equal("10"))
+				Ω(decodeError(response, nil).Code).Should(Equal(builds.ErrorRateLimited))
+
+				Ω(getBuilds("pass").StatusCode).Should(Equal(http.StatusTooManyRequests))
+			})
+		})
+	})
+
+	Describe("secret params", func() {
+		var build builds.Build
+
+		BeforeEach(func() {
+			build = createBuild(builds.Build{
+				Config: TurbineBuilds.Config{
+					Image: "ubuntu",
+					Params: map[string]string{
+						"GITHUB_TOKEN": "gh-token-value",
+						"DB_URL":       "postgres://user:hunter22@db",
+						"REGION":       "eu-west-1",
+					},
+				},
+				SecretParams: []string{"DB_URL"},
+			})
+		})
+
+		redactedParams := map[string]string{
+			"GITHUB_TOKEN": builds.RedactedValue,
+			"DB_URL":       builds.RedactedValue,
+			"REGION":       "eu-west-1",
+		}
+
+		It("redacts them when the build is created", func() {
+			Ω(build.Config.Params).Should(Equal(redactedParams))
+		})
+
+		It("redacts them when builds are listed", func() {
+			response, err := client.Get(server.URL + "/builds")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			var returnedBuilds []builds.Build
+			err = json.NewDecoder(response.Body).Decode(&returnedBuilds)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(returnedBuilds).Should(HaveLen(1))
+			Ω(returnedBuilds[0].Config.Params).Should(Equal(redactedParams))
+		})
+
+		It("keeps them out of the server's logs", func() {
+			Ω(logger.Buffer.Contents()).ShouldNot(ContainSubstring("gh-token-value"))
+			Ω(logger.Buffer.Contents()).ShouldNot(ContainSubstring("hunter22"))
+			Ω(logger.Buffer.Contents()).Should(ContainSubstring("eu-west-1"))
+		})
+
+		It("still forwards them to turbine", func() {
+			var turbineBuild TurbineBuilds.Build
+
+			turbineServer.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/builds"),
+					func(w http.ResponseWriter, r *http.Request) {
+						json.NewDecoder(r.Body).Decode(&turbineBuild)
+					},
+					ghttp.RespondWithJSONEncoded(201, TurbineBuilds.Build{}),
+				),
+			)
+
+			go client.Get(server.URL + "/builds/" + build.Guid + "/bits")
+
+			response, err := client.Post(
+				server.URL+"/builds/"+build.Guid+"/bits",
+				"application/octet-stream",
+				bytes.NewBufferString("some-bits"),
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(response.StatusCode).Should(Equal(http.StatusCreated))
+
+			Ω(turbineBuild.Config.Params).Should(Equal(map[string]string{
+				"GITHUB_TOKEN": "gh-token-value",
+				"DB_URL":       "postgres://user:hunter22@db",
+				"REGION":       "eu-west-1",
+			}))
+		})
+
+		It("scrubs their values from the build's log", func() {
+			inConn, _, err := websocket.DefaultDialer.Dial(
+				fmt.Sprintf("ws://%s/builds/%s/log/input", server.Listener.Addr().String(), build.Guid),
+				nil,
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			defer inConn.Close()
+
+			err = inConn.WriteJSON(map[string]interface{}{
+				"type":    "log",
+				"payload": "cloning with gh-token-value in eu-west-1",
+				"origin":  map[string]interface{}{"id": 1},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			outConn, _, err := websocket.DefaultDialer.Dial(
+				fmt.Sprintf("ws://%s/builds/%s/log/output", server.Listener.Addr().String(), build.Guid),
+				nil,
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			defer outConn.Close()
+
+			var event map[string]interface{}
+			err = outConn.ReadJSON(&event)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(event).Should(Equal(map[string]interface{}{
+				"type":    "log",
+				"payload": "cloning with [redacted] in eu-west-1",
+				"origin":  map[string]interface{}{"id": float64(1)},
+			}))
+		})
+
+		It("scrubs values containing characters JSON may escape for HTML", func() {
+			build = createBuild(builds.Build{
+				Config: TurbineBuilds.Config{
+					Image: "ubuntu",
+					Params: map[string]string{
+						"DB_PASSWORD": "p<ss>&word",
+					},
+				},
+				SecretParams: []string{"DB_PASSWORD"},
+			})
+
+			inConn, _, err := websocket.DefaultDialer.Dial(
+				fmt.Sprintf("ws://%s/builds/%s/log/input", server.Listener.Addr().String(), build.Guid),
+				nil,
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			defer inConn.Close()
+
+			// written as is, rather than by an encoder that escapes them
+			err = inConn.WriteMessage(websocket.TextMessage, []byte(`{"type":"log","payload":"logging in with p<ss>&word"}`))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			outConn, _, err := websocket.DefaultDialer.Dial(
+				fmt.Sprintf("ws://%s/builds/%s/log/output", server.Listener.Addr().String(), build.Guid),
+				nil,
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			defer outConn.Close()
+
+			var event map[string]interface{}
+			err = outConn.ReadJSON(&event)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(event).Should(Equal(map[string]interface{}{
+				"type":    "log",
+				"payload": "logging in with [redacted]",
+			}))
+		})
+	})
+
+	Describe("secret params at rest", func() {
+		oldKey := secrets.Key{ID: "old", Key: bytes.Repeat([]byte{1}, 32)}
+		newKey := secrets.Key{ID: "new", Key: bytes.Repeat([]byte{2}, 32)}
+
+		var build builds.Build
+
+		storedParams := func() map[string]string {
+			stored, err := buildStore.Builds()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(stored).Should(HaveLen(1))
+
+			return stored[0].Config.Params
+		}
+
+		useKeys := func(keys ...secrets.Key) {
+			var err error
+			keyring, err = secrets.NewKeyring(keys)
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+
+		BeforeEach(func() {
+			useKeys(oldKey)
+			reserve()
+
+			build = createBuild(builds.Build{
+				Config: TurbineBuilds.Config{
+					Image: "ubuntu",
+					Params: map[string]string{
+						"GITHUB_TOKEN": "gh-token-value",
+						"REGION":       "eu-west-1",
+					},
+				},
+			})
+		})
+
+		It("stores them encrypted with the first key", func() {
+			params := storedParams()
+			Ω(params["GITHUB_TOKEN"]).Should(MatchRegexp("^encrypted:old:"))
+			Ω(params["GITHUB_TOKEN"]).ShouldNot(ContainSubstring("gh-token-value"))
+			Ω(params["REGION"]).Should(Equal("eu-west-1"))
+		})
+
+		It("forwards them to turbine decrypted", func() {
+			var turbineBuild TurbineBuilds.Build
+
+			turbineServer.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/builds"),
+					func(w http.ResponseWriter, r *http.Request) {
+						json.NewDecoder(r.Body).Decode(&turbineBuild)
+					},
+					ghttp.RespondWithJSONEncoded(201, TurbineBuilds.Build{}),
+				),
+			)
+
+			go client.Get(server.URL + "/builds/" + build.Guid + "/bits")
+
+			response, err := client.Post(
+				server.URL+"/builds/"+build.Guid+"/bits",
+				"application/octet-stream",
+				bytes.NewBufferString("some-bits"),
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(response.StatusCode).Should(Equal(http.StatusCreated))
+
+			Ω(turbineBuild.Config.Params).Should(Equal(map[string]string{
+				"GITHUB_TOKEN": "gh-token-value",
+				"REGION":       "eu-west-1",
+			}))
+		})
+
+		Context("when restarted with a new key in front of the old one", func() {
+			BeforeEach(func() {
+				useKeys(newKey, oldKey)
+				reserve()
+			})
+
+			It("re-encrypts them with the new key", func() {
+				params := storedParams()
+				Ω(params["GITHUB_TOKEN"]).Should(MatchRegexp("^encrypted:new:"))
+
+				decrypted, err := keyring.Decrypt(params["GITHUB_TOKEN"])
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(decrypted).Should(Equal("gh-token-value"))
+			})
+		})
+
+		Context("when they were stored before a key was given", func() {
+			BeforeEach(func() {
+				buildStore = store.NewMemoryStore()
+				keyring = nil
+				reserve()
+
+				createBuild(builds.Build{
+					Config: TurbineBuilds.Config{
+						Image: "ubuntu",
+						Params: map[string]string{
+							"GITHUB_TOKEN": "gh-token-value",
+						},
+					},
+				})
+
+				Ω(storedParams()["GITHUB_TOKEN"]).Should(Equal("gh-token-value"))
+
+				useKeys(newKey)
+				reserve()
+			})
+
+			It("encrypts them on startup", func() {
+				Ω(storedParams()["GITHUB_TOKEN"]).Should(MatchRegexp("^encrypted:new:"))
+			})
+		})
+
+		Context("in templates", func() {
+			storedTemplateParams := func() map[string]string {
+				stored, err := buildStore.Templates()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(stored).Should(HaveLen(1))
+
+				return stored[0].Config.Params
+			}
+
+			BeforeEach(func() {
+				payload, err := json.Marshal(builds.Template{
+					Config: TurbineBuilds.Config{
+						Image: "ubuntu",
+						Params: map[string]string{
+							"DEPLOY_TOKEN": "deploy-token-value",
+							"TARGET":       "((target))",
+						},
+					},
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				req, err := http.NewRequest("PUT", server.URL+"/templates/deploy", bytes.NewBuffer(payload))
+				Ω(err).ShouldNot(HaveOccurred())
+
+				response, err := client.Do(req)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(response.StatusCode).Should(Equal(http.StatusCreated))
+			})
+
+			It("stores them encrypted", func() {
+				params := storedTemplateParams()
+				Ω(params["DEPLOY_TOKEN"]).Should(MatchRegexp("^encrypted:old:"))
+				Ω(params["TARGET"]).Should(Equal("((target))"))
+			})
+
+			It("forwards them to turbine decrypted in builds created from the template", func() {
+				var turbineBuild TurbineBuilds.Build
+
+				turbineServer.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("POST", "/builds"),
+						func(w http.ResponseWriter, r *http.Request) {
+							json.NewDecoder(r.Body).Decode(&turbineBuild)
+						},
+						ghttp.RespondWithJSONEncoded(201, TurbineBuilds.Build{}),
+					),
+				)
+
+				fromTemplate := createBuild(builds.Build{
+					Template:       "deploy",
+					TemplateParams: map[string]string{"target": "prod"},
+				})
+
+				go client.Get(server.URL + "/builds/" + fromTemplate.Guid + "/bits")
+
+				response, err := client.Post(
+					server.URL+"/builds/"+fromTemplate.Guid+"/bits",
+					"application/octet-stream",
+					bytes.NewBufferString("some-bits"),
+				)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(response.StatusCode).Should(Equal(http.StatusCreated))
+
+				Ω(turbineBuild.Config.Params).Should(Equal(map[string]string{
+					"DEPLOY_TOKEN": "deploy-token-value",
+					"TARGET":       "prod",
+				}))
+			})
+
+			Context("when restarted with a new key in front of the old one", func() {
+				BeforeEach(func() {
+					useKeys(newKey, oldKey)
+					reserve()
+				})
+
+				It("re-encrypts them with the new key", func() {
+					params := storedTemplateParams()
+					Ω(params["DEPLOY_TOKEN"]).Should(MatchRegexp("^encrypted:new:"))
+
+					decrypted, err := keyring.Decrypt(params["DEPLOY_TOKEN"])
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(decrypted).Should(Equal("deploy-token-value"))
+				})
+			})
+		})
+
+		Context("when restarted without a key", func() {
+			It("fails to start", func() {
+				withoutKey := config()
+				withoutKey.Keyring = nil
+
+				_, err := api.New(withoutKey)
+				Ω(err).Should(HaveOccurred())
+			})
+		})
+	})
+
+	Describe("templates", func() {
+		putTemplate := func(name string, template builds.Template) *http.Response {
+			payload, err := json.Marshal(template)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			req, err := http.NewRequest("PUT", server.URL+"/templates/"+name, bytes.NewBuffer(payload))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			response, err := client.Do(req)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			return response
+		}
+
+		postBuild := func(build builds.Build) *http.Response {
+			response, err := client.Post(
+				server.URL+"/builds",
+				"application/json",
+				bytes.NewBufferString(buildPayload(&build)),
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			return response
+		}
+
+		migrate := builds.Template{
+			Config: TurbineBuilds.Config{
+				Image: "docker:///app:((version))",
+				Params: map[string]string{
+					"DATABASE":   "((database))",
+					"DB_API_KEY": "((key))",
+				},
+				Run: TurbineBuilds.RunConfig{
+					Path: "bin/migrate",
+					Args: []string{"--to", "((version))"},
+				},
+			},
+		}
+
+		var response *http.Response
+
+		BeforeEach(func() {
+			response = putTemplate("migrate", migrate)
+		})
+
+		Describe("PUT /templates/:name", func() {
+			It("returns 201 with the template and its placeholders", func() {
+				Ω(response.StatusCode).Should(Equal(http.StatusCreated))
+
+				var template builds.Template
+				err := json.NewDecoder(response.Body).Decode(&template)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(template.Name).Should(Equal("migrate"))
+				Ω(template.Placeholders).Should(Equal([]string{"database", "key", "version"}))
+				Ω(template.Config.Params["DB_API_KEY"]).Should(Equal(builds.RedactedValue))
+			})
+
+			It("returns 200 when replacing the template", func() {
+				response := putTemplate("migrate", migrate)
+				Ω(response.StatusCode).Should(Equal(http.StatusOK))
+			})
+
+			It("returns 400 for an invalid name", func() {
+				response := putTemplate("..", migrate)
+				Ω(response.StatusCode).Should(Equal(http.StatusBadRequest))
+			})
+		})
+
+		Describe("GET /templates", func() {
+			It("lists the templates by name", func() {
+				putTemplate("smoke", builds.Template{Config: TurbineBuilds.Config{Image: "ubuntu"}})
+
+				response, err := client.Get(server.URL + "/templates")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(response.StatusCode).Should(Equal(http.StatusOK))
+
+				var templates []builds.Template
+				err = json.NewDecoder(response.Body).Decode(&templates)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(templates).Should(HaveLen(2))
+				Ω(templates[0].Name).Should(Equal("migrate"))
+				Ω(templates[1].Name).Should(Equal("smoke"))
+			})
+		})
+
+		Describe("GET /templates/:name", func() {
+			It("returns the template", func() {
+				response, err := client.Get(server.URL + "/templates/migrate")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(response.StatusCode).Should(Equal(http.StatusOK))
+
+				var template builds.Template
+				err = json.NewDecoder(response.Body).Decode(&template)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(template.Config.Run).Should(Equal(migrate.Config.Run))
+			})
+
+			It("returns 404 for an unknown template", func() {
+				response, err := client.Get(server.URL + "/templates/bogus")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(response.StatusCode).Should(Equal(http.StatusNotFound))
+
+				apiErr := decodeError(response, nil)
+				Ω(apiErr.Code).Should(Equal(builds.ErrorTemplateNotFound))
+			})
+
+			It("keeps templates across restarts", func() {
+				reserve()
+
+				response, err := client.Get(server.URL + "/templates/migrate")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(response.StatusCode).Should(Equal(http.StatusOK))
+			})
+		})
+
+		Describe("DELETE /templates/:name", func() {
+			It("removes the template", func() {
+				req, err := http.NewRequest("DELETE", server.URL+"/templates/migrate", nil)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				response, err := client.Do(req)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(response.StatusCode).Should(Equal(http.StatusNoContent))
+
+				response, err = client.Get(server.URL + "/templates/migrate")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(response.StatusCode).Should(Equal(http.StatusNotFound))
+
+				stored, err := buildStore.Templates()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(stored).Should(BeEmpty())
+			})
+		})
+
+		Context("when another team's user looks for the template", func() {
+			BeforeEach(func() {
+				authenticator = auth.NewBasicAuthenticator([]auth.User{
+					{Name: "alice", Password: "pass", Team: "team-a"},
+					{Name: "bob", Password: "pass", Team: "team-b"},
+				})
+
+				reserve()
+
+				client.Transport = basicAuthTransport("alice", "pass")
+				putTemplate("alices", migrate)
+
+				client.Transport = basicAuthTransport("bob", "pass")
+			})
+
+			It("is not found", func() {
+				response, err := client.Get(server.URL + "/templates/alices")
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(response.StatusCode).Should(Equal(http.StatusNotFound))
+			})
+		})
+
+		Describe("creating a build from a template", func() {
+			It("fills in the placeholders and merges the build's config on top", func() {
+				response := postBuild(builds.Build{
+					Template: "migrate",
+					TemplateParams: map[string]string{
+						"version":  "1.2",
+						"database": "prod",
+						"key":      "s3cr3t-key",
+					},
+					Config: TurbineBuilds.Config{
+						Params: map[string]string{"VERBOSE": "true"},
+					},
+				})
+				Ω(response.StatusCode).Should(Equal(http.StatusCreated))
+
+				var build builds.Build
+				err := json.NewDecoder(response.Body).Decode(&build)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(build.Template).Should(Equal("migrate"))
+				Ω(build.TemplateParams).Should(BeEmpty())
+				Ω(build.Config).Should(Equal(TurbineBuilds.Config{
+					Image: "docker:///app:1.2",
+					Params: map[string]string{
+						"DATABASE":   "prod",
+						"DB_API_KEY": builds.RedactedValue,
+						"VERBOSE":    "true",
+					},
+					Run: TurbineBuilds.RunConfig{
+						Path: "bin/migrate",
+						Args: []string{"--to", "1.2"},
+					},
+				}))
+
+				stored, err := buildStore.Builds()
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(stored).Should(HaveLen(1))
+				Ω(stored[0].TemplateParams).Should(BeEmpty())
+			})
+
+			It("reports missing and unknown template params", func() {
+				response := postBuild(builds.Build{
+					Template: "migrate",
+					TemplateParams: map[string]string{
+						"version": "1.2",
+						"verison": "1.2",
+					},
+				})
+				Ω(response.StatusCode).Should(Equal(http.StatusBadRequest))
+
+				var violations []policy.Violation
+				apiErr := decodeError(response, &violations)
+				Ω(apiErr.Code).Should(Equal(builds.ErrorInvalidBuild))
+				Ω(violations).Should(Equal([]policy.Violation{
+					{Rule: "template", Message: "missing template param: database"},
+					{Rule: "template", Message: "missing template param: key"},
+					{Rule: "template", Message: "unknown template param: verison"},
+				}))
+			})
+
+			It("rejects an unknown template", func() {
+				response := postBuild(builds.Build{
+					Template: "bogus",
+					Config:   TurbineBuilds.Config{Image: "ubuntu"},
+				})
+				Ω(response.StatusCode).Should(Equal(http.StatusBadRequest))
+
+				var violations []policy.Violation
+				decodeError(response, &violations)
+				Ω(violations).Should(Equal([]policy.Violation{
+					{Rule: "template", Message: "template 'bogus' not found"},
+				}))
+			})
+		})
+	})
+
+	Describe("POST /builds/:guid/bits", func() {
+		var build builds.Build
+
+		var response *http.Response
+
+		BeforeEach(func() {
+			build = builds.Build{
+				Guid: "some-guid",
+			}
+		})
+
+		JustBeforeEach(func() {
+			var err error
+
+			// set up a consumer
+			go client.Get(server.URL + "/builds/" + build.Guid + "/bits")
+
+			response, err = client.Post(
+				server.URL+"/builds/"+build.Guid+"/bits",
+				"application/octet-stream",
+				bytes.NewBufferString("streamed body"),
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		Context("with a valid build guid", func() {
+			BeforeEach(func() {
+				build = createBuild(builds.Build{
+					Name: "some-name",
+					Config: TurbineBuilds.Config{
+						Image: "ubuntu",
+						Params: map[string]string{
+							"FOO": "bar",
+						},
+						Run: TurbineBuilds.RunConfig{
+							Path: "ls",
+							Args: []string{"-al", "/"},
+						},
+					},
+				})
+			})
+
+			BeforeEach(func() {
+				turbineBuild := TurbineBuilds.Build{
+					Guid: build.Guid,
+
+					Privileged: false,
+
+					Config: TurbineBuilds.Config{
+						Image: "ubuntu",
+						Params: map[string]string{
+							"FOO": "bar",
+						},
+						Run: TurbineBuilds.RunConfig{
+							Path: "ls",
+							Args: []string{"-al", "/"},
+						},
+					},
+
+					Inputs: []TurbineBuilds.Input{
+						{
+							Name: "some-name",
+							Type: "archive",
+							Source: TurbineBuilds.Source{
+								"uri": "http://peer-addr/builds/" + build.Guid + "/bits",
+							},
+						},
+					},
+
+					StatusCallback: "http://peer-addr/builds/" + build.Guid + "/result",
+					EventsCallback: "ws://peer-addr/builds/" + build.Guid + "/log/input",
+				}
+
+				turbineServer.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("POST", "/builds"),
+						ghttp.VerifyJSONRepresenting(turbineBuild),
+						ghttp.RespondWithJSONEncoded(201, turbineBuild),
+					),
+				)
+			})
+
+			It("triggers a build and returns 201", func() {
+				Ω(response.StatusCode).Should(Equal(http.StatusCreated))
+			})
+
+			Context("when the build is privileged", func() {
+				BeforeEach(func() {
+					buildPolicy.Privileged.Allowed = true
+					reserve()
+
+					build = createBuild(builds.Build{
+						Name:       "some-name",
+						Privileged: true,
+						Config: TurbineBuilds.Config{
+							Image: "ubuntu",
+						},
+					})
+
+					turbineServer.SetHandler(0, ghttp.CombineHandlers(
+						ghttp.VerifyRequest("POST", "/builds"),
+						func(w http.ResponseWriter, r *http.Request) {
+							var turbineBuild TurbineBuilds.Build
+							err := json.NewDecoder(r.Body).Decode(&turbineBuild)
+							Ω(err).ShouldNot(HaveOccurred())
+
+							Ω(turbineBuild.Privileged).Should(BeTrue())
+						},
+						ghttp.RespondWithJSONEncoded(201, TurbineBuilds.Build{}),
+					))
+				})
+
+				It("triggers a privileged build", func() {
+					Ω(response.StatusCode).Should(Equal(http.StatusCreated))
+				})
+			})
+
+			Context("when turbine fails", func() {
+				BeforeEach(func() {
+					turbineServer.SetHandler(0, ghttp.RespondWith(500, ""))
+				})
+
+				It("returns 500", func() {
+					Ω(response.StatusCode).Should(Equal(http.StatusServiceUnavailable))
+				})
+
+				It("includes turbine's status in the error", func() {
+					var details builds.UpstreamDetails
+					apiErr := decodeError(response, &details)
+					Ω(apiErr.Code).Should(Equal(builds.ErrorTurbineRejected))
+					Ω(details.Status).Should(Equal(500))
+				})
+			})
+		})
+
+		Context("with an invalid build guid", func() {
+			It("returns 404", func() {
+				Ω(response.StatusCode).Should(Equal(http.StatusNotFound))
+			})
+
+			It("describes the error", func() {
+				apiErr := decodeError(response, nil)
+				Ω(apiErr.Code).Should(Equal(builds.ErrorBuildNotFound))
+			})
+		})
+	})
+
+	Describe("GET /builds/:guid/bits", func() {
+		var build builds.Build
+
+		var response *http.Response
+
+		BeforeEach(func() {
+			build = builds.Build{
+				Guid: "some-guid",
+			}
+		})
+
+		streamBits := func() {
+			var err error
+
+			response, err = client.Get(server.URL + "/builds/" + build.Guid + "/bits")
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+
+		JustBeforeEach(streamBits)
+
+		Context("with a valid build guid", func() {
+			BeforeEach(func() {
+				build = createBuild(builds.Build{Config: TurbineBuilds.Config{Image: "ubuntu"}})
+			})
+
+			Context("with bits", func() {
+				BeforeEach(func() {
+					gotBits := &sync.WaitGroup{}
+					gotBits.Add(1)
+
+					turbineServer.AppendHandlers(
+						ghttp.CombineHandlers(
+							func(w http.ResponseWriter, req *http.Request) {
+								gotBits.Done()
+							},
+							ghttp.RespondWithJSONEncoded(201, TurbineBuilds.Build{}),
+						),
+					)
+
+					go func() {
+						defer GinkgoRecover()
+
+						_, err := client.Post(
+							server.URL+"/builds/"+build.Guid+"/bits",
+							"application/octet-stream",
+							bytes.NewBufferString("streamed body"),
+						)
+						Ω(err).ShouldNot(HaveOccurred())
+					}()
+
+					gotBits.Wait()
+				})
+
+				It("returns 200", func() {
+					Ω(response.StatusCode).Should(Equal(http.StatusOK))
+				})
+
+				It("streams the bits that are being uploaded", func() {
+					body, err := ioutil.ReadAll(response.Body)
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(string(body)).Should(Equal("streamed body"))
+				})
+			})
+
+			Context("with no bits within 1 second", func() {
+				var startedAt time.Time
+
+				BeforeEach(func() {
+					startedAt = time.Now()
+				})
+
+				It("returns 404", func() {
+					Ω(response.StatusCode).Should(Equal(http.StatusNotFound))
+					Ω(time.Since(startedAt)).Should(BeNumerically(">=", time.Second))
+				})
+			})
+		})
+
+		Context("with an invalid build guid", func() {
+			It("returns 404", func() {
+				Ω(response.StatusCode).Should(Equal(http.StatusNotFound))
+			})
+		})
+	})
+
+	Describe("GET /builds/:guid/hijack", func() {
+		var build builds.Build
+
+		var conn *websocket.Conn
+		var frames chan builds.HijackFrame
+
+		Context("with a valid build guid", func() {
+			BeforeEach(func() {
+				// managing sessions across builds is for admins
+				authenticator = auth.NoopAuthenticator{Admin: true}
+				reserve()
+
+				build = createBuild(builds.Build{Config: TurbineBuilds.Config{Image: "ubuntu"}})
+
+				trigger(build.Guid, TurbineBuilds.Build{
+					HijackURL: turbineServer.URL() + "/hijack",
+				})
+			})
+
+			JustBeforeEach(func() {
+				var err error
+
+				conn, _, err = websocket.DefaultDialer.Dial(
+					fmt.Sprintf("ws://%s/builds/%s/hijack", server.Listener.Addr().String(), build.Guid),
+					nil,
+				)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				err = conn.WriteJSON(builds.HijackFrame{
+					Type: builds.HijackFrameSpec,
+					Spec: json.RawMessage(`{"path":"bash"}`),
+				})
+				Ω(err).ShouldNot(HaveOccurred())
+
+				frames = make(chan builds.HijackFrame, 10)
+
+				go func() {
+					defer close(frames)
+
+					for {
+						var frame builds.HijackFrame
+						err := conn.ReadJSON(&frame)
+						if err != nil {
+							return
+						}
+
+						frames <- frame
+					}
+				}()
+			})
+
+			AfterEach(func() {
+				conn.Close()
+			})
+
+			Context("when turbine starts the process", func() {
+				BeforeEach(func() {
+					turbineServer.AppendHandlers(
+						ghttp.CombineHandlers(
+							ghttp.VerifyRequest("POST", "/hijack"),
+							func(w http.ResponseWriter, r *http.Request) {
+								var spec map[string]string
+								err := json.NewDecoder(r.Body).Decode(&spec)
+								Ω(err).ShouldNot(HaveOccurred())
+								Ω(spec).Should(Equal(map[string]string{"path": "bash"}))
+
+								w.WriteHeader(http.StatusOK)
+
+								conn, br, err := w.(http.Hijacker).Hijack()
+								Ω(err).ShouldNot(HaveOccurred())
+
+								defer conn.Close()
+
+								// the session may be terminated before any input is sent
+								line, err := br.ReadString('\n')
+								if err != nil {
+									return
+								}
+
+								fmt.Fprintf(conn, "echo: %s", line)
+							},
+						),
+					)
+				})
+
+				It("frames the process's stdio", func() {
+					err := conn.WriteJSON(builds.HijackFrame{
+						Type: builds.HijackFrameStdin,
+						Data: []byte("hello\n"),
+					})
+					Ω(err).ShouldNot(HaveOccurred())
+
+					var frame builds.HijackFrame
+					Eventually(frames).Should(Receive(&frame))
+					Ω(frame.Type).Should(Equal(builds.HijackFrameStdout))
+					Ω(string(frame.Data)).Should(Equal("echo: hello\n"))
+
+					Eventually(frames).Should(Receive(&frame))
+					Ω(frame.Type).Should(Equal(builds.HijackFrameExit))
+
+					Eventually(frames).Should(BeClosed())
+				})
+
+				Describe("managing active sessions", func() {
+					getActiveHijacks := func() []builds.HijackSession {
+						response, err := client.Get(server.URL + "/hijacks")
+						Ω(err).ShouldNot(HaveOccurred())
+						Ω(response.StatusCode).Should(Equal(http.StatusOK))
+
+						var sessions []builds.HijackSession
+						err = json.NewDecoder(response.Body).Decode(&sessions)
+						Ω(err).ShouldNot(HaveOccurred())
+
+						return sessions
+					}
+
+					It("lists the session as active", func() {
+						Eventually(getActiveHijacks).Should(HaveLen(1))
+
+						session := getActiveHijacks()[0]
+						Ω(session.Build).Should(Equal(build.Guid))
+						Ω(session.Active).Should(BeTrue())
+					})
+
+					It("can terminate the session", func() {
+						Eventually(getActiveHijacks).Should(HaveLen(1))
+
+						req, err := http.NewRequest("DELETE", server.URL+"/builds/"+build.Guid+"/hijacks/"+getActiveHijacks()[0].ID, nil)
+						Ω(err).ShouldNot(HaveOccurred())
+
+						response, err := client.Do(req)
+						Ω(err).ShouldNot(HaveOccurred())
+						Ω(response.StatusCode).Should(Equal(http.StatusNoContent))
+
+						Eventually(frames).Should(BeClosed())
+						Eventually(getActiveHijacks).Should(BeEmpty())
+					})
+
+					It("terminates the session when the build finishes", func() {
+						Eventually(getActiveHijacks).Should(HaveLen(1))
+
+						req, err := http.NewRequest("PUT", server.URL+"/builds/"+build.Guid+"/result", bytes.NewBufferString(`{"status":"succeeded"}`))
+						Ω(err).ShouldNot(HaveOccurred())
+
+						response, err := client.Do(req)
+						Ω(err).ShouldNot(HaveOccurred())
+						Ω(response.StatusCode).Should(Equal(http.StatusOK))
+
+						Eventually(frames).Should(BeClosed())
+						Eventually(getActiveHijacks).Should(BeEmpty())
+					})
+
+					Context("when the build has reached its limit of sessions", func() {
+						BeforeEach(func() {
+							maxHijacksPerBuild = 1
+							reserve()
+						})
+
+						It("refuses another with 429", func() {
+							_, response, err := websocket.DefaultDialer.Dial(
+								fmt.Sprintf("ws://%s/builds/%s/hijack", server.Listener.Addr().String(), build.Guid),
+								nil,
+							)
+							Ω(err).Should(HaveOccurred())
+							Ω(response.StatusCode).Should(Equal(http.StatusTooManyRequests))
+
+							Ω(decodeError(response, nil).Code).Should(Equal(builds.ErrorTooManyHijacks))
+						})
+					})
+
+					Context("with an unknown session id", func() {
+						It("returns 404", func() {
+							req, err := http.NewRequest("DELETE", server.URL+"/builds/"+build.Guid+"/hijacks/bogus-id", nil)
+							Ω(err).ShouldNot(HaveOccurred())
+
+							response, err := client.Do(req)
+							Ω(err).ShouldNot(HaveOccurred())
+							Ω(response.StatusCode).Should(Equal(http.StatusNotFound))
+
+							Ω(decodeError(response, nil).Code).Should(Equal(builds.ErrorHijackNotFound))
+						})
+					})
+				})
+
+				Context("when the session is idle for too long", func() {
+					BeforeEach(func() {
+						hijackIdleTimeout = 200 * time.Millisecond
+						reserve()
+					})
+
+					It("terminates it", func() {
+						Consistently(frames, 100*time.Millisecond).ShouldNot(BeClosed())
+						Eventually(frames).Should(BeClosed())
+					})
+				})
+
+				Context("when the session lasts too long", func() {
+					BeforeEach(func() {
+						hijackTimeout = 200 * time.Millisecond
+						reserve()
+					})
+
+					It("terminates it", func() {
+						Eventually(frames).Should(BeClosed())
+					})
+				})
+
+				Describe("the session's audit record", func() {
+					var sessions []builds.HijackSession
+
+					getHijacks := func() []builds.HijackSession {
+						response, err := client.Get(server.URL + "/builds/" + build.Guid + "/hijacks")
+						Ω(err).ShouldNot(HaveOccurred())
+						Ω(response.StatusCode).Should(Equal(http.StatusOK))
+
+						err = json.NewDecoder(response.Body).Decode(&sessions)
+						Ω(err).ShouldNot(HaveOccurred())
+
+						return sessions
+					}
+
+					JustBeforeEach(func() {
+						err := conn.WriteJSON(builds.HijackFrame{
+							Type: builds.HijackFrameStdin,
+							Data: []byte("hello\n"),
+						})
+						Ω(err).ShouldNot(HaveOccurred())
+
+						Eventually(frames).Should(BeClosed())
+
+						Eventually(func() time.Time {
+							sessions := getHijacks()
+							if len(sessions) == 0 {
+								return time.Time{}
+							}
+
+							return sessions[0].EndedAt
+						}).ShouldNot(BeZero())
+					})
+
+					It("is listed with the build's hijacks", func() {
+						Ω(sessions).Should(HaveLen(1))
+						Ω(sessions[0].ID).ShouldNot(BeEmpty())
+						Ω(sessions[0].Build).Should(Equal(build.Guid))
+						Ω(sessions[0].StartedAt).ShouldNot(BeZero())
+						Ω(sessions[0].Duration).Should(BeNumerically(">", 0))
+						Ω(sessions[0].Recorded).Should(BeFalse())
+					})
+
+					It("has no recording", func() {
+						response, err := client.Get(server.URL + "/builds/" + build.Guid + "/hijacks/" + sessions[0].ID + "/recording")
+						Ω(err).ShouldNot(HaveOccurred())
+						Ω(response.StatusCode).Should(Equal(http.StatusNotFound))
+
+						Ω(decodeError(response, nil).Code).Should(Equal(builds.ErrorRecordingNotFound))
+					})
+
+					Context("when hijacks are recorded", func() {
+						BeforeEach(func() {
+							recordHijacks = true
+							reserve()
+						})
+
+						It("serves the transcript in asciicast format", func() {
+							Ω(sessions).Should(HaveLen(1))
+							Ω(sessions[0].Recorded).Should(BeTrue())
+
+							response, err := client.Get(server.URL + "/builds/" + build.Guid + "/hijacks/" + sessions[0].ID + "/recording")
+							Ω(err).ShouldNot(HaveOccurred())
+							Ω(response.StatusCode).Should(Equal(http.StatusOK))
+							Ω(response.Header.Get("Content-Type")).Should(Equal("application/x-asciicast"))
+
+							lines := []json.RawMessage{}
+
+							decoder := json.NewDecoder(response.Body)
+							for decoder.More() {
+								var line json.RawMessage
+								err := decoder.Decode(&line)
+								Ω(err).ShouldNot(HaveOccurred())
+
+								lines = append(lines, line)
+							}
+
+							Ω(lines).Should(HaveLen(3))
+							Ω(string(lines[0])).Should(ContainSubstring(`"version":2`))
+							Ω(string(lines[1])).Should(MatchRegexp(`^\[[0-9.e-]+,"i","hello\\n"\]$`))
+							Ω(string(lines[2])).Should(MatchRegexp(`^\[[0-9.e-]+,"o","echo: hello\\n"\]$`))
+						})
+
+						Context("beyond the maximum recording size", func() {
+							BeforeEach(func() {
+								maxRecordingSize = 1
+								reserve()
+							})
+
+							It("stops recording and marks the session truncated", func() {
+								Ω(sessions).Should(HaveLen(1))
+								Ω(sessions[0].Recorded).Should(BeTrue())
+								Ω(sessions[0].Truncated).Should(BeTrue())
+
+								response, err := client.Get(server.URL + "/builds/" + build.Guid + "/hijacks/" + sessions[0].ID + "/recording")
+								Ω(err).ShouldNot(HaveOccurred())
+								Ω(response.StatusCode).Should(Equal(http.StatusOK))
+
+								body, err := ioutil.ReadAll(response.Body)
+								Ω(err).ShouldNot(HaveOccurred())
+
+								Ω(string(body)).Should(ContainSubstring(`"version":2`))
+								Ω(string(body)).ShouldNot(ContainSubstring("hello"))
+							})
+						})
+					})
+				})
+			})
+
+			Context("when turbine refuses", func() {
+				BeforeEach(func() {
+					turbineServer.AppendHandlers(
+						ghttp.CombineHandlers(
+							ghttp.VerifyRequest("POST", "/hijack"),
+							ghttp.RespondWith(http.StatusNotFound, "no such container"),
+						),
+					)
+				})
+
+				It("sends an error frame", func() {
+					var frame builds.HijackFrame
+					Eventually(frames).Should(Receive(&frame))
+					Ω(frame.Type).Should(Equal(builds.HijackFrameError))
+					Ω(frame.Message).Should(ContainSubstring("no such container"))
+
+					Eventually(frames).Should(BeClosed())
+				})
+			})
+		})
+
+		Context("with an invalid build guid", func() {
+			It("fails the handshake with 404", func() {
+				_, response, err := websocket.DefaultDialer.Dial(
+					fmt.Sprintf("ws://%s/builds/bogus-guid/hijack", server.Listener.Addr().String()),
+					nil,
+				)
+				Ω(err).Should(HaveOccurred())
+				Ω(response.StatusCode).Should(Equal(http.StatusNotFound))
+			})
+		})
+	})
+
+	Describe("POST /builds/:guid/abort", func() {
+		var build builds.Build
+
+		abort := func(reason string) *http.Response {
+			response, err := client.Post(
+				server.URL+"/builds/"+build.Guid+"/abort",
+				"application/json",
+				bytes.NewBufferString(`{"reason":"`+reason+`"}`),
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			return response
+		}
+
+		getBuild := func() builds.Build {
+			response, err := client.Get(server.URL + "/builds")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			var returnedBuilds []builds.Build
+			err = json.NewDecoder(response.Body).Decode(&returnedBuilds)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			for _, returned := range returnedBuilds {
+				if returned.Guid == build.Guid {
+					return returned
+				}
+			}
+
+			Fail("build not found")
+			return builds.Build{}
+		}
+
+		BeforeEach(func() {
+			authenticator = auth.NewBasicAuthenticator([]auth.User{
+				{Name: "alice", Password: "pass"},
+			})
+
+			reserve()
+
+			client.Transport = basicAuthTransport("alice", "pass")
+
+			build = createBuild(builds.Build{Config: TurbineBuilds.Config{Image: "ubuntu"}})
+		})
+
+		Context("when the build is pending", func() {
+			It("aborts it without involving turbine", func() {
+				response := abort("changed my mind")
+				Ω(response.StatusCode).Should(Equal(http.StatusOK))
+
+				aborted := getBuild()
+				Ω(aborted.Status).Should(Equal(builds.StatusAborted))
+				Ω(aborted.AbortedBy).Should(Equal("alice"))
+				Ω(aborted.AbortReason).Should(Equal("changed my mind"))
+				Ω(aborted.FinishedAt).ShouldNot(BeZero())
+
+				Ω(turbineServer.ReceivedRequests()).Should(BeEmpty())
+			})
+
+			It("ends the build's log", func() {
+				outConn, _, err := websocket.DefaultDialer.Dial(
+					fmt.Sprintf("ws://%s/builds/%s/log/output", server.Listener.Addr().String(), build.Guid),
+					http.Header{"Authorization": {"Basic YWxpY2U6cGFzcw=="}},
+				)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				abort("")
+
+				var msg interface{}
+				err = outConn.ReadJSON(&msg)
+				Ω(err).Should(HaveOccurred())
+			})
+
+			It("refuses any bits uploaded afterwards", func() {
+				abort("")
+
+				response, err := client.Post(
+					server.URL+"/builds/"+build.Guid+"/bits",
+					"application/octet-stream",
+					bytes.NewBufferString("some-bits"),
+				)
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(response.StatusCode).Should(Equal(http.StatusConflict))
+
+				Ω(decodeError(response, nil).Code).Should(Equal(builds.ErrorBuildFinished))
+			})
+
+			Context("and it is aborted again", func() {
+				It("returns 409", func() {
+					abort("")
+
+					response := abort("")
+					Ω(response.StatusCode).Should(Equal(http.StatusConflict))
+
+					Ω(decodeError(response, nil).Code).Should(Equal(builds.ErrorBuildFinished))
+				})
+			})
+		})
+
+		Context("when turbine is still accepting the build", func() {
+			var uploaded chan *http.Response
+			var turbineReceived chan struct{}
+			var turbineBlocked chan struct{}
+
+			BeforeEach(func() {
+				turbineReceived = make(chan struct{})
+				turbineBlocked = make(chan struct{})
+
+				turbineServer.AppendHandlers(
+					ghttp.CombineHandlers(
+						ghttp.VerifyRequest("POST", "/builds"),
+						func(w http.ResponseWriter, r *http.Request) {
+							close(turbineReceived)
+							<-turbineBlocked
+						},
+						ghttp.RespondWithJSONEncoded(201, TurbineBuilds.Build{}),
+					),
+				)
+
+				uploaded = make(chan *http.Response, 1)
+
+				go func() {
+					defer GinkgoRecover()
+
+					response, err := client.Post(
+						server.URL+"/builds/"+build.Guid+"/bits",
+						"application/octet-stream",
+						bytes.NewBufferString("some-bits"),
+					)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					uploaded <- response
+				}()
+
+				Eventually(turbineReceived).Should(BeClosed())
+			})
+
+			AfterEach(func() {
+				close(turbineBlocked)
+			})
+
+			It("cancels the upload", func() {
+				response := abort("")
+				Ω(response.StatusCode).Should(Equal(http.StatusOK))
+
+				var uploadResponse *http.Response
+				Eventually(uploaded).Should(Receive(&uploadResponse))
+				Ω(uploadResponse.StatusCode).Should(Equal(http.StatusConflict))
+
+				Ω(getBuild().Status).Should(Equal(builds.StatusAborted))
+			})
+		})
+
+		Context("when the build has been triggered", func() {
+			BeforeEach(func() {
+				trigger(build.Guid, TurbineBuilds.Build{
+					AbortURL: turbineServer.URL() + "/abort",
+				})
+			})
+
+			Context("and turbine aborts it", func() {
+				BeforeEach(func() {
+					turbineServer.AppendHandlers(
+						ghttp.CombineHandlers(
+							ghttp.VerifyRequest("POST", "/abort"),
+							ghttp.RespondWith(200, ""),
+						),
+					)
+				})
+
+				It("marks the build as aborted", func() {
+					response := abort("wrong branch")
+					Ω(response.StatusCode).Should(Equal(http.StatusOK))
+
+					Ω(turbineServer.ReceivedRequests()).Should(HaveLen(2))
+
+					aborted := getBuild()
+					Ω(aborted.Status).Should(Equal(builds.StatusAborted))
+					Ω(aborted.AbortedBy).Should(Equal("alice"))
+					Ω(aborted.AbortReason).Should(Equal("wrong branch"))
+				})
+
+				It("ignores the result turbine reports afterwards", func() {
+					abort("")
+
+					req, err := http.NewRequest("PUT", server.URL+"/builds/"+build.Guid+"/result", bytes.NewBufferString(`{"status":"errored"}`))
+					Ω(err).ShouldNot(HaveOccurred())
+
+					response, err := client.Do(req)
+					Ω(err).ShouldNot(HaveOccurred())
+					Ω(response.StatusCode).Should(Equal(http.StatusOK))
+
+					Ω(getBuild().Status).Should(Equal(builds.StatusAborted))
+				})
+			})
+
+			Context("and turbine fails to abort it", func() {
+				BeforeEach(func() {
+					turbineServer.AppendHandlers(
+						ghttp.CombineHandlers(
+							ghttp.VerifyRequest("POST", "/abort"),
+							ghttp.RespondWith(500, "nope"),
+						),
+					)
+				})
+
+				It("passes turbine's error along and leaves the build alone", func() {
+					response := abort("")
+					Ω(response.StatusCode).Should(Equal(http.StatusInternalServerError))
+
+					Ω(decodeError(response, nil).Code).Should(Equal(builds.ErrorTurbineRejected))
+
+					Ω(getBuild().Status).Should(BeEmpty())
+				})
+			})
+		})
+
+		Context("with an invalid build guid", func() {
+			It("returns 404", func() {
+				build.Guid = "bogus-guid"
+
+				response := abort("")
+				Ω(response.StatusCode).Should(Equal(http.StatusNotFound))
+			})
+		})
+	})
+
+	Describe("GET/PUT /builds/:guid/result", func() {
+		var build builds.Build
+		var endpoint string
+		var resultPayload string
+
+		var response *http.Response
+
+		BeforeEach(func() {
+			build = builds.Build{
+				Guid: "some-guid",
+			}
+
+			resultPayload = `{"status":"succeeded"}`
+		})
+
+		JustBeforeEach(func() {
+			var err error
+
+			endpoint = server.URL + "/builds/" + build.Guid + "/result"
+
+			req, err := http.NewRequest("PUT", endpoint, nil)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			reqPayload := bytes.NewBufferString(resultPayload)
+			req.Header.Set("Content-Type", "application/json")
+			req.Body = ioutil.NopCloser(reqPayload)
+
+			response, err = client.Do(req)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		Context("with a valid build guid", func() {
+			BeforeEach(func() {
+				build = createBuild(
+					builds.Build{
+						Config: TurbineBuilds.Config{
+							Image: "ubuntu",
+						},
+					},
+				)
+			})
+
+			It("returns 200", func() {
+				Ω(response.StatusCode).Should(Equal(http.StatusOK))
+			})
+
+			It("updates the build's status", func() {
+				response, err := client.Get(endpoint)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(response.StatusCode).Should(Equal(http.StatusOK))
+
+				var result builds.BuildResult
+				err = json.NewDecoder(response.Body).Decode(&result)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(result.Status).Should(Equal("succeeded"))
+			})
+
+			Context("when the result carries an exit status and error", func() {
+				JustBeforeEach(func() {
+					req, err := http.NewRequest("PUT", endpoint, bytes.NewBufferString(`{"status":"errored","exit_status":137,"error":"out of memory"}`))
+					Ω(err).ShouldNot(HaveOccurred())
+
+					response, err = client.Do(req)
+					Ω(err).ShouldNot(HaveOccurred())
+				})
+
+				It("returns them with the result", func() {
+					response, err := client.Get(endpoint)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					var result builds.BuildResult
+					err = json.NewDecoder(response.Body).Decode(&result)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(result.Status).Should(Equal("errored"))
+					Ω(result.ExitStatus).ShouldNot(BeNil())
+					Ω(*result.ExitStatus).Should(Equal(137))
+					Ω(result.Error).Should(Equal("out of memory"))
+				})
+
+				It("includes them in the build", func() {
+					response, err := client.Get(server.URL + "/builds")
+					Ω(err).ShouldNot(HaveOccurred())
+
+					var returnedBuilds []builds.Build
+					err = json.NewDecoder(response.Body).Decode(&returnedBuilds)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(returnedBuilds).Should(HaveLen(1))
+					Ω(returnedBuilds[0].ExitStatus).ShouldNot(BeNil())
+					Ω(*returnedBuilds[0].ExitStatus).Should(Equal(137))
+					Ω(returnedBuilds[0].Error).Should(Equal("out of memory"))
+				})
+			})
+
+			Context("when the status is unknown", func() {
+				BeforeEach(func() {
+					resultPayload = `{"status":"bogus"}`
+				})
+
+				It("returns 400", func() {
+					Ω(response.StatusCode).Should(Equal(http.StatusBadRequest))
+					Ω(decodeError(response, nil).Code).Should(Equal(builds.ErrorMalformedRequest))
+				})
+
+				It("leaves the build's status alone", func() {
+					response, err := client.Get(endpoint)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					var result builds.BuildResult
+					err = json.NewDecoder(response.Body).Decode(&result)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(result.Status).Should(BeEmpty())
+				})
+
+				It("does not count it in the metrics", func() {
+					recorder := httptest.NewRecorder()
+					metrics.Handler().ServeHTTP(recorder, &http.Request{})
+
+					Ω(recorder.Body.String()).ShouldNot(ContainSubstring(`status="bogus"`))
+				})
+			})
+		})
+
+		Context("with an invalid build guid", func() {
+			It("returns 404", func() {
+				Ω(response.StatusCode).Should(Equal(http.StatusNotFound))
+			})
+		})
+	})
+
+	Describe("GET /builds/:guid/result?wait=true", func() {
+		var build builds.Build
+
+		putResult := func(status string) {
+			req, err := http.NewRequest("PUT", server.URL+"/builds/"+build.Guid+"/result", bytes.NewBufferString(`{"status":"`+status+`"}`))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			response, err := client.Do(req)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(response.StatusCode).Should(Equal(http.StatusOK))
+		}
+
+		waitForResult := func(timeout string) <-chan *http.Response {
+			responses := make(chan *http.Response, 1)
+
+			go func() {
+				defer GinkgoRecover()
+
+				response, err := client.Get(server.URL + "/builds/" + build.Guid + "/result?wait=true&timeout=" + timeout)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				responses <- response
+			}()
+
+			return responses
+		}
+
+		BeforeEach(func() {
+			build = createBuild(builds.Build{Config: TurbineBuilds.Config{Image: "ubuntu"}})
+		})
+
+		It("blocks until the build finishes", func() {
+			responses := waitForResult("10s")
+
+			putResult("started")
+			Consistently(responses).ShouldNot(Receive())
+
+			putResult("failed")
+
+			var response *http.Response
+			Eventually(responses).Should(Receive(&response))
+			Ω(response.StatusCode).Should(Equal(http.StatusOK))
+
+			var result builds.BuildResult
+			err := json.NewDecoder(response.Body).Decode(&result)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(result.Status).Should(Equal("failed"))
+			Ω(result.FinishedAt).ShouldNot(BeZero())
+		})
+
+		Context("when the build has already finished", func() {
+			BeforeEach(func() {
+				putResult("succeeded")
+			})
+
+			It("returns immediately", func() {
+				var response *http.Response
+				Eventually(waitForResult("10s")).Should(Receive(&response))
+				Ω(response.StatusCode).Should(Equal(http.StatusOK))
+
+				var result builds.BuildResult
+				err := json.NewDecoder(response.Body).Decode(&result)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(result.Status).Should(Equal("succeeded"))
+			})
+		})
+
+		Context("when the timeout elapses", func() {
+			It("returns 202 with the current result", func() {
+				putResult("started")
+
+				var response *http.Response
+				Eventually(waitForResult("100ms")).Should(Receive(&response))
+				Ω(response.StatusCode).Should(Equal(http.StatusAccepted))
+
+				var result builds.BuildResult
+				err := json.NewDecoder(response.Body).Decode(&result)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(result.Status).Should(Equal("started"))
+				Ω(result.FinishedAt).Should(BeZero())
+			})
+		})
+
+		Context("with a timeout in seconds", func() {
+			It("accepts it", func() {
+				var response *http.Response
+				Eventually(waitForResult("0")).Should(Receive(&response))
+				Ω(response.StatusCode).Should(Equal(http.StatusAccepted))
+			})
+		})
+
+		Context("with a malformed timeout", func() {
+			It("returns 400", func() {
+				var response *http.Response
+				Eventually(waitForResult("soon")).Should(Receive(&response))
+				Ω(response.StatusCode).Should(Equal(http.StatusBadRequest))
+
+				Ω(decodeError(response, nil).Code).Should(Equal(builds.ErrorMalformedRequest))
+			})
+		})
+	})
+
+	Describe("/builds/:guid/log/input", func() {
+		var build builds.Build
+		var endpoint string
+
+		var conn *websocket.Conn
+
+		BeforeEach(func() {
+			build = builds.Build{
+				Guid: "some-guid",
+			}
+
+			endpoint = fmt.Sprintf(
+				"ws://%s/builds/%s/log/input",
+				server.Listener.Addr().String(),
+				build.Guid,
+			)
+		})
+
+		Context("with a valid build guid", func() {
+			BeforeEach(func() {
+				build = createBuild(
+					builds.Build{
+						Config: TurbineBuilds.Config{
+							Image: "ubuntu",
 						},
 					},
+				)
+
+				endpoint = fmt.Sprintf(
+					"ws://%s/builds/%s/log/input",
+					server.Listener.Addr().String(),
+					build.Guid,
+				)
+			})
+
+			Context("when messages are written", func() {
+				BeforeEach(func() {
+					var err error
+
+					conn, _, err = websocket.DefaultDialer.Dial(endpoint, nil)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					err = conn.WriteJSON("hello1")
+					Ω(err).ShouldNot(HaveOccurred())
+
+					err = conn.WriteJSON("hello2")
+					Ω(err).ShouldNot(HaveOccurred())
+
+					err = conn.WriteJSON("hello3")
+					Ω(err).ShouldNot(HaveOccurred())
+				})
+
+				AfterEach(func() {
+					conn.Close()
+				})
+
+				outputSink := func() <-chan interface{} {
+					outEndpoint := fmt.Sprintf(
+						"ws://%s/builds/%s/log/output",
+						server.Listener.Addr().String(),
+						build.Guid,
+					)
+
+					outConn, _, err := websocket.DefaultDialer.Dial(outEndpoint, nil)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					messages := make(chan interface{})
+
+					go func() {
+						for {
+							var msg interface{}
+							err := outConn.ReadJSON(&msg)
+							if err != nil {
+								break
+							}
+
+							messages <- msg
+						}
+					}()
 
-					StatusCallback: "http://peer-addr/builds/" + build.Guid + "/result",
-					EventsCallback: "ws://peer-addr/builds/" + build.Guid + "/log/input",
+					return messages
 				}
 
-				turbineServer.AppendHandlers(
-					ghttp.CombineHandlers(
-						ghttp.VerifyRequest("POST", "/builds"),
-						ghttp.VerifyJSONRepresenting(turbineBuild),
-						ghttp.RespondWithJSONEncoded(201, turbineBuild),
-					),
+				It("presents them to /builds/{guid}/logs/output", func() {
+					sink := outputSink()
+					Eventually(sink).Should(Receive(Equal("hello1")))
+					Eventually(sink).Should(Receive(Equal("hello2")))
+					Eventually(sink).Should(Receive(Equal("hello3")))
+				})
+
+				It("streams them to all open connections to /build/{guid}/logs/output", func() {
+					sink1 := outputSink()
+					sink2 := outputSink()
+
+					msg := "hello4"
+
+					err := conn.WriteJSON(msg)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Eventually(sink1).Should(Receive(Equal(msg)))
+					Eventually(sink2).Should(Receive(Equal(msg)))
+				})
+
+				It("keeps accepting messages after a viewer disconnects mid-replay", func() {
+					// more than the socket buffers hold, so the viewer is gone
+					// before the replay is done
+					chunk := strings.Repeat("x", 1024*1024)
+
+					for i := 0; i < 10; i++ {
+						err := conn.WriteJSON(chunk)
+						Ω(err).ShouldNot(HaveOccurred())
+					}
+
+					err := conn.WriteJSON("replayed")
+					Ω(err).ShouldNot(HaveOccurred())
+
+					sink := outputSink()
+					Eventually(sink, 10*time.Second).Should(Receive(Equal("replayed")))
+
+					viewer, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf(
+						"ws://%s/builds/%s/log/output",
+						server.Listener.Addr().String(),
+						build.Guid,
+					), nil)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					var msg interface{}
+					err = viewer.ReadJSON(&msg)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					viewer.Close()
+
+					err = conn.WriteJSON("hello4")
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Eventually(sink, 10*time.Second).Should(Receive(Equal("hello4")))
+				})
+			})
+
+			Context("with keepalives", func() {
+				BeforeEach(func() {
+					keepaliveInterval = 50 * time.Millisecond
+					reserve()
+				})
+
+				// dial connects to the build's log endpoint, reading until the
+				// connection is closed
+				dial := func(endpoint string, respond bool) <-chan struct{} {
+					conn, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf(
+						"ws://%s/builds/%s/log/%s",
+						server.Listener.Addr().String(),
+						build.Guid,
+						endpoint,
+					), nil)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					if !respond {
+						conn.SetPingHandler(func(string) error { return nil })
+					}
+
+					closed := make(chan struct{})
+
+					go func() {
+						defer close(closed)
+
+						for {
+							_, _, err := conn.NextReader()
+							if err != nil {
+								return
+							}
+						}
+					}()
+
+					return closed
+				}
+
+				Context("on log output", func() {
+					It("keeps connections that answer pings open", func() {
+						Consistently(dial("output", true), 300*time.Millisecond).ShouldNot(BeClosed())
+					})
+
+					It("closes connections that stop answering pings", func() {
+						Eventually(dial("output", false)).Should(BeClosed())
+					})
+				})
+
+				Context("on log input", func() {
+					It("does not end the log when the emitter never reads", func() {
+						emitter, _, err := websocket.DefaultDialer.Dial(fmt.Sprintf(
+							"ws://%s/builds/%s/log/input",
+							server.Listener.Addr().String(),
+							build.Guid,
+						), nil)
+						Ω(err).ShouldNot(HaveOccurred())
+
+						defer emitter.Close()
+
+						err = emitter.WriteJSON("hello1")
+						Ω(err).ShouldNot(HaveOccurred())
+
+						viewer := dial("output", true)
+
+						Consistently(viewer, 300*time.Millisecond).ShouldNot(BeClosed())
+
+						err = emitter.WriteJSON("hello2")
+						Ω(err).ShouldNot(HaveOccurred())
+
+						Consistently(viewer, 100*time.Millisecond).ShouldNot(BeClosed())
+					})
+				})
+			})
+		})
+	})
+
+	Describe("restarting with a persistent store", func() {
+		var storeDir string
+		var build builds.Build
+
+		BeforeEach(func() {
+			var err error
+
+			storeDir, err = ioutil.TempDir("", "glider-store")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			buildStore, err = store.NewDirStore(storeDir)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			reserve()
+
+			build = createBuild(builds.Build{Config: TurbineBuilds.Config{Image: "ubuntu"}})
+
+			req, err := http.NewRequest("PUT", server.URL+"/builds/"+build.Guid+"/result", bytes.NewBufferString(`{"status":"failed"}`))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = client.Do(req)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			buildStore, err = store.NewDirStore(storeDir)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			reserve()
+		})
+
+		AfterEach(func() {
+			os.RemoveAll(storeDir)
+		})
+
+		It("restores the builds", func() {
+			response, err := client.Get(server.URL + "/builds")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			var receivedBuilds []builds.Build
+			err = json.NewDecoder(response.Body).Decode(&receivedBuilds)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(receivedBuilds).Should(HaveLen(1))
+			Ω(receivedBuilds[0].Guid).Should(Equal(build.Guid))
+			Ω(receivedBuilds[0].Status).Should(Equal("failed"))
+		})
+	})
+
+	Describe("webhooks", func() {
+		var receiver *ghttp.Server
+		var payloads chan webhooks.Payload
+
+		receive := func(status int) http.HandlerFunc {
+			return ghttp.CombineHandlers(
+				ghttp.VerifyRequest("POST", "/hook"),
+				func(w http.ResponseWriter, r *http.Request) {
+					body, err := ioutil.ReadAll(r.Body)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(r.Header.Get(webhooks.SignatureHeader)).Should(Equal(webhooks.Sign([]byte("secret"), body)))
+
+					var payload webhooks.Payload
+					err = json.Unmarshal(body, &payload)
+					Ω(err).ShouldNot(HaveOccurred())
+
+					Ω(r.Header.Get(webhooks.EventHeader)).Should(Equal(string(payload.Event)))
+
+					payloads <- payload
+				},
+				ghttp.RespondWith(status, ""),
+			)
+		}
+
+		BeforeEach(func() {
+			receiver = ghttp.NewServer()
+			payloads = make(chan webhooks.Payload, 10)
+
+			notifier = webhooks.NewNotifier(
+				lagertest.NewTestLogger("webhooks"),
+				[]string{receiver.URL() + "/hook"},
+				"secret",
+				3,
+				10*time.Millisecond,
+			)
+
+			reserve()
+		})
+
+		AfterEach(func() {
+			receiver.Close()
+		})
+
+		getDeliveries := func(guid string) []webhooks.Delivery {
+			response, err := client.Get(server.URL + "/builds/" + guid + "/deliveries")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(response.StatusCode).Should(Equal(http.StatusOK))
+
+			var deliveries []webhooks.Delivery
+			err = json.NewDecoder(response.Body).Decode(&deliveries)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			return deliveries
+		}
+
+		Context("when a build is created", func() {
+			var build builds.Build
+
+			BeforeEach(func() {
+				receiver.AppendHandlers(receive(200))
+
+				build = createBuild(builds.Build{
+					Config: TurbineBuilds.Config{Image: "ubuntu"},
+					Labels: map[string]string{"ticket": "OPS-123"},
+				})
+			})
+
+			It("delivers a signed created event with the build", func() {
+				var payload webhooks.Payload
+				Eventually(payloads).Should(Receive(&payload))
+
+				Ω(payload.Event).Should(Equal(webhooks.EventCreated))
+				Ω(payload.Build.Guid).Should(Equal(build.Guid))
+				Ω(payload.Build.Labels).Should(Equal(map[string]string{"ticket": "OPS-123"}))
+			})
+
+			It("records the delivery", func() {
+				Eventually(func() []webhooks.Delivery {
+					return getDeliveries(build.Guid)
+				}).Should(HaveLen(1))
+
+				Eventually(func() string {
+					return getDeliveries(build.Guid)[0].Status
+				}).Should(Equal(webhooks.DeliveryDelivered))
+
+				delivery := getDeliveries(build.Guid)[0]
+				Ω(delivery.Event).Should(Equal(webhooks.EventCreated))
+				Ω(delivery.URL).Should(Equal(receiver.URL() + "/hook"))
+				Ω(delivery.Attempts).Should(Equal(1))
+				Ω(delivery.ResponseStatus).Should(Equal(200))
+			})
+
+			Context("and turbine reports its progress", func() {
+				putResult := func(status string) {
+					req, err := http.NewRequest("PUT", server.URL+"/builds/"+build.Guid+"/result", bytes.NewBufferString(`{"status":"`+status+`"}`))
+					Ω(err).ShouldNot(HaveOccurred())
+
+					_, err = client.Do(req)
+					Ω(err).ShouldNot(HaveOccurred())
+				}
+
+				BeforeEach(func() {
+					receiver.AppendHandlers(receive(200), receive(200))
+				})
+
+				It("delivers started and finished events", func() {
+					Eventually(payloads).Should(Receive())
+
+					putResult("started")
+
+					var payload webhooks.Payload
+					Eventually(payloads).Should(Receive(&payload))
+					Ω(payload.Event).Should(Equal(webhooks.EventStarted))
+
+					putResult("succeeded")
+
+					Eventually(payloads).Should(Receive(&payload))
+					Ω(payload.Event).Should(Equal(webhooks.EventFinished))
+					Ω(payload.Build.Status).Should(Equal("succeeded"))
+				})
+			})
+		})
+
+		Context("when the receiver fails", func() {
+			var build builds.Build
+
+			BeforeEach(func() {
+				receiver.AppendHandlers(receive(500), receive(200))
+
+				build = createBuild(builds.Build{Config: TurbineBuilds.Config{Image: "ubuntu"}})
+			})
+
+			It("retries the delivery", func() {
+				Eventually(payloads).Should(Receive())
+				Eventually(payloads).Should(Receive())
+
+				Eventually(func() string {
+					return getDeliveries(build.Guid)[0].Status
+				}).Should(Equal(webhooks.DeliveryDelivered))
+
+				Ω(getDeliveries(build.Guid)[0].Attempts).Should(Equal(2))
+			})
+		})
+
+		Context("when the build has its own notify url", func() {
+			var buildReceiver *ghttp.Server
+
+			BeforeEach(func() {
+				buildReceiver = ghttp.NewServer()
+				buildReceiver.AppendHandlers(receive(200))
+				receiver.AppendHandlers(receive(200))
+
+				buildPolicy = policy.Policy{
+					AllowedNotifyHosts: []string{"127.0.0.1"},
+				}
+				reserve()
+
+				createBuild(builds.Build{
+					Config: TurbineBuilds.Config{Image: "ubuntu"},
+					Notify: []string{buildReceiver.URL() + "/hook"},
+				})
+			})
+
+			AfterEach(func() {
+				buildReceiver.Close()
+			})
+
+			It("delivers to both the global and the build's webhooks", func() {
+				Eventually(payloads).Should(Receive())
+				Eventually(payloads).Should(Receive())
+
+				Ω(receiver.ReceivedRequests()).Should(HaveLen(1))
+				Ω(buildReceiver.ReceivedRequests()).Should(HaveLen(1))
+			})
+		})
+
+		Context("when the build's notify url redirects", func() {
+			var buildReceiver *ghttp.Server
+			var elsewhere *ghttp.Server
+			var build builds.Build
+
+			BeforeEach(func() {
+				elsewhere = ghttp.NewServer()
+
+				buildReceiver = ghttp.NewServer()
+				buildReceiver.RouteToHandler("POST", "/hook", ghttp.RespondWith(
+					http.StatusFound,
+					"",
+					http.Header{"Location": {elsewhere.URL() + "/hook"}},
+				))
+				receiver.AppendHandlers(receive(200))
+
+				buildPolicy = policy.Policy{
+					AllowedNotifyHosts: []string{"127.0.0.1"},
+				}
+				reserve()
+
+				build = createBuild(builds.Build{
+					Config: TurbineBuilds.Config{Image: "ubuntu"},
+					Notify: []string{buildReceiver.URL() + "/hook"},
+				})
+			})
+
+			AfterEach(func() {
+				buildReceiver.Close()
+				elsewhere.Close()
+			})
+
+			It("does not follow it", func() {
+				buildDelivery := func() webhooks.Delivery {
+					for _, delivery := range getDeliveries(build.Guid) {
+						if delivery.URL == buildReceiver.URL()+"/hook" {
+							return delivery
+						}
+					}
+
+					return webhooks.Delivery{}
+				}
+
+				Eventually(func() string { return buildDelivery().Status }).Should(Equal(webhooks.DeliveryFailed))
+				Ω(buildDelivery().ResponseStatus).Should(Equal(http.StatusFound))
+
+				Ω(elsewhere.ReceivedRequests()).Should(BeEmpty())
+			})
+		})
+
+		Context("when the build's notify url is not on an allowed host", func() {
+			It("returns 403 without delivering to it", func() {
+				response, err := client.Post(
+					server.URL+"/builds",
+					"application/json",
+					bytes.NewBufferString(`{"config":{"image":"ubuntu"},"notify":["http://169.254.169.254/latest"]}`),
 				)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(response.StatusCode).Should(Equal(http.StatusForbidden))
+
+				var violations []policy.Violation
+				decodeError(response, &violations)
+				Ω(violations).Should(Equal([]policy.Violation{
+					{Rule: policy.RuleNotifyHosts, Message: "notify host '169.254.169.254' is not allowed"},
+				}))
 			})
+		})
 
-			It("triggers a build and returns 201", func() {
-				Ω(response.StatusCode).Should(Equal(http.StatusCreated))
+		Context("when the build's notify url is invalid", func() {
+			It("returns 400", func() {
+				response, err := client.Post(
+					server.URL+"/builds",
+					"application/json",
+					bytes.NewBufferString(`{"config":{"image":"ubuntu"},"notify":["ftp://example.com"]}`),
+				)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(response.StatusCode).Should(Equal(http.StatusBadRequest))
+			})
+		})
+
+		Describe("GET /builds/:guid/deliveries with an invalid build guid", func() {
+			It("returns 404", func() {
+				response, err := client.Get(server.URL + "/builds/bogus/deliveries")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(response.StatusCode).Should(Equal(http.StatusNotFound))
+			})
+		})
+	})
+
+	Describe("GET /events", func() {
+		putResult := func(guid string, status string) {
+			req, err := http.NewRequest("PUT", server.URL+"/builds/"+guid+"/result", bytes.NewBufferString(`{"status":"`+status+`"}`))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = client.Do(req)
+			Ω(err).ShouldNot(HaveOccurred())
+		}
+
+		Context("over a websocket", func() {
+			var conn *websocket.Conn
+			var received chan events.Event
+
+			BeforeEach(func() {
+				var err error
+
+				conn, _, err = websocket.DefaultDialer.Dial(fmt.Sprintf("ws://%s/events", server.Listener.Addr().String()), nil)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				received = make(chan events.Event, 10)
+
+				go func() {
+					defer close(received)
+
+					for {
+						var event events.Event
+						err := conn.ReadJSON(&event)
+						if err != nil {
+							return
+						}
+
+						received <- event
+					}
+				}()
+			})
+
+			AfterEach(func() {
+				conn.Close()
+			})
+
+			It("streams events for every build", func() {
+				build1 := createBuild(builds.Build{Config: TurbineBuilds.Config{Image: "ubuntu"}})
+				build2 := createBuild(builds.Build{Config: TurbineBuilds.Config{Image: "ubuntu"}})
+
+				putResult(build1.Guid, "started")
+
+				var event events.Event
+
+				Eventually(received).Should(Receive(&event))
+				Ω(event.Type).Should(Equal(events.Created))
+				Ω(event.Build.Guid).Should(Equal(build1.Guid))
+
+				Eventually(received).Should(Receive(&event))
+				Ω(event.Type).Should(Equal(events.Created))
+				Ω(event.Build.Guid).Should(Equal(build2.Guid))
+
+				Eventually(received).Should(Receive(&event))
+				Ω(event.Type).Should(Equal(events.StatusChanged))
+				Ω(event.Build.Guid).Should(Equal(build1.Guid))
+				Ω(event.Build.Status).Should(Equal("started"))
 			})
 
-			Context("when turbine fails", func() {
-				BeforeEach(func() {
-					turbineServer.SetHandler(0, ghttp.RespondWith(500, ""))
-				})
+			It("ends the stream when draining", func() {
+				drainer.Drain()
 
-				It("returns 500", func() {
-					Ω(response.StatusCode).Should(Equal(http.StatusServiceUnavailable))
-				})
+				Eventually(received).Should(BeClosed())
 			})
 		})
 
-		Context("with an invalid build guid", func() {
-			It("returns 404", func() {
-				Ω(response.StatusCode).Should(Equal(http.StatusNotFound))
+		Context("as server-sent events", func() {
+			var response *http.Response
+			var reader *bufio.Reader
+
+			BeforeEach(func() {
+				var err error
+
+				response, err = client.Get(server.URL + "/events")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(response.StatusCode).Should(Equal(http.StatusOK))
+				Ω(response.Header.Get("Content-Type")).Should(Equal("text/event-stream"))
+
+				reader = bufio.NewReader(response.Body)
 			})
-		})
-	})
 
-	Describe("GET /builds/:guid/bits", func() {
-		var build builds.Build
+			AfterEach(func() {
+				response.Body.Close()
+			})
 
-		var response *http.Response
+			It("streams events for every build", func() {
+				build := createBuild(builds.Build{Config: TurbineBuilds.Config{Image: "ubuntu"}})
 
-		BeforeEach(func() {
-			build = builds.Build{
-				Guid: "some-guid",
-			}
+				line, err := reader.ReadString('\n')
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(line).Should(Equal("event: created\n"))
+
+				line, err = reader.ReadString('\n')
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(line).Should(MatchRegexp("^data: "))
+
+				var event events.Event
+				err = json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &event)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(event.Type).Should(Equal(events.Created))
+				Ω(event.Build.Guid).Should(Equal(build.Guid))
+			})
 		})
+	})
 
-		streamBits := func() {
-			var err error
+	Describe("draining", func() {
+		putResult := func(guid string, status string) {
+			req, err := http.NewRequest("PUT", server.URL+"/builds/"+guid+"/result", bytes.NewBufferString(`{"status":"`+status+`"}`))
+			Ω(err).ShouldNot(HaveOccurred())
 
-			response, err = client.Get(server.URL + "/builds/" + build.Guid + "/bits")
+			response, err := client.Do(req)
 			Ω(err).ShouldNot(HaveOccurred())
+			Ω(response.StatusCode).Should(Equal(http.StatusOK))
 		}
 
-		JustBeforeEach(streamBits)
+		Describe("POST /admin/drain", func() {
+			var response *http.Response
 
-		Context("with a valid build guid", func() {
 			BeforeEach(func() {
-				build = createBuild(builds.Build{Config: TurbineBuilds.Config{Image: "ubuntu"}})
+				authenticator = auth.NoopAuthenticator{Admin: true}
+				reserve()
 			})
 
-			Context("with bits", func() {
-				BeforeEach(func() {
-					gotBits := &sync.WaitGroup{}
-					gotBits.Add(1)
+			JustBeforeEach(func() {
+				var err error
 
-					turbineServer.AppendHandlers(
-						ghttp.CombineHandlers(
-							func(w http.ResponseWriter, req *http.Request) {
-								gotBits.Done()
-							},
-							ghttp.RespondWithJSONEncoded(201, TurbineBuilds.Build{}),
-						),
-					)
+				response, err = client.Post(server.URL+"/admin/drain", "application/json", nil)
+				Ω(err).ShouldNot(HaveOccurred())
+			})
 
-					go func() {
-						defer GinkgoRecover()
+			It("returns 202", func() {
+				Ω(response.StatusCode).Should(Equal(http.StatusAccepted))
+			})
 
-						_, err := client.Post(
-							server.URL+"/builds/"+build.Guid+"/bits",
-							"application/octet-stream",
-							bytes.NewBufferString("streamed body"),
-						)
-						Ω(err).ShouldNot(HaveOccurred())
-					}()
+			It("starts draining", func() {
+				Ω(drainer.IsDraining()).Should(BeTrue())
+			})
 
-					gotBits.Wait()
-				})
+			It("rejects new builds with 503", func() {
+				response, err := client.Post(
+					server.URL+"/builds",
+					"application/json",
+					bytes.NewBufferString(buildPayload(&builds.Build{Config: TurbineBuilds.Config{Image: "ubuntu"}})),
+				)
+				Ω(err).ShouldNot(HaveOccurred())
 
-				It("returns 200", func() {
-					Ω(response.StatusCode).Should(Equal(http.StatusOK))
+				Ω(response.StatusCode).Should(Equal(http.StatusServiceUnavailable))
+				Ω(decodeError(response, nil).Code).Should(Equal(builds.ErrorDraining))
+			})
+
+			It("reports that glider is not ready", func() {
+				turbineServer.AllowUnhandledRequests = true
+
+				response, err := client.Get(server.URL + "/readyz")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				Ω(response.StatusCode).Should(Equal(http.StatusServiceUnavailable))
+			})
+
+			Context("when the caller is not an admin", func() {
+				BeforeEach(func() {
+					authenticator = auth.NewBasicAuthenticator([]auth.User{
+						{Name: "alice", Password: "pass"},
+					})
+
+					reserve()
+
+					client.Transport = basicAuthTransport("alice", "pass")
 				})
 
-				It("streams the bits that are being uploaded", func() {
-					body, err := ioutil.ReadAll(response.Body)
-					Ω(err).ShouldNot(HaveOccurred())
-					Ω(string(body)).Should(Equal("streamed body"))
+				It("returns 403", func() {
+					Ω(response.StatusCode).Should(Equal(http.StatusForbidden))
+					Ω(drainer.IsDraining()).Should(BeFalse())
 				})
 			})
 
-			Context("with no bits within 1 second", func() {
-				var startedAt time.Time
-
+			Context("when authentication is disabled", func() {
 				BeforeEach(func() {
-					startedAt = time.Now()
+					authenticator = auth.NoopAuthenticator{}
+					reserve()
 				})
 
-				It("returns 404", func() {
-					Ω(response.StatusCode).Should(Equal(http.StatusNotFound))
-					Ω(time.Since(startedAt)).Should(BeNumerically(">=", time.Second))
+				It("does not treat anonymous callers as admins", func() {
+					Ω(response.StatusCode).Should(Equal(http.StatusForbidden))
+					Ω(drainer.IsDraining()).Should(BeFalse())
 				})
 			})
 		})
 
-		Context("with an invalid build guid", func() {
-			It("returns 404", func() {
-				Ω(response.StatusCode).Should(Equal(http.StatusNotFound))
-			})
-		})
-	})
+		Describe("draining with running builds", func() {
+			var build builds.Build
+			var drained chan struct{}
 
-	Describe("GET/PUT /builds/:guid/result", func() {
-		var build builds.Build
-		var endpoint string
+			BeforeEach(func() {
+				drainer = drain.NewDrainer(time.Minute)
+				reserve()
 
-		var response *http.Response
+				build = createBuild(builds.Build{Config: TurbineBuilds.Config{Image: "ubuntu"}})
+				putResult(build.Guid, "started")
 
-		BeforeEach(func() {
-			build = builds.Build{
-				Guid: "some-guid",
-			}
-		})
+				drained = make(chan struct{})
+			})
 
-		JustBeforeEach(func() {
-			var err error
+			JustBeforeEach(func() {
+				go func() {
+					drainer.Drain()
+					close(drained)
+				}()
+			})
 
-			endpoint = server.URL + "/builds/" + build.Guid + "/result"
+			It("waits for turbine to report their result", func() {
+				Consistently(drained, 300*time.Millisecond).ShouldNot(BeClosed())
 
-			req, err := http.NewRequest("PUT", endpoint, nil)
-			Ω(err).ShouldNot(HaveOccurred())
+				putResult(build.Guid, "succeeded")
 
-			reqPayload := bytes.NewBufferString(`{"status":"succeeded"}`)
-			req.Header.Set("Content-Type", "application/json")
-			req.Body = ioutil.NopCloser(reqPayload)
+				Eventually(drained).Should(BeClosed())
+			})
 
-			response, err = client.Do(req)
-			Ω(err).ShouldNot(HaveOccurred())
-		})
+			It("refuses new bits uploads with 503", func() {
+				Eventually(drainer.IsDraining).Should(BeTrue())
 
-		Context("with a valid build guid", func() {
-			BeforeEach(func() {
-				build = createBuild(
-					builds.Build{
-						Config: TurbineBuilds.Config{
-							Image: "ubuntu",
-						},
-					},
+				response, err := client.Post(
+					server.URL+"/builds/"+build.Guid+"/bits",
+					"application/octet-stream",
+					bytes.NewBufferString("some-bits"),
 				)
-			})
+				Ω(err).ShouldNot(HaveOccurred())
+				Ω(response.StatusCode).Should(Equal(http.StatusServiceUnavailable))
+				Ω(decodeError(response, nil).Code).Should(Equal(builds.ErrorDraining))
 
-			It("returns 200", func() {
-				Ω(response.StatusCode).Should(Equal(http.StatusOK))
+				Ω(turbineServer.ReceivedRequests()).Should(BeEmpty())
+
+				putResult(build.Guid, "succeeded")
+
+				Eventually(drained).Should(BeClosed())
 			})
 
-			It("updates the build's status", func() {
-				response, err := client.Get(endpoint)
+			It("closes their logs once drained", func() {
+				outConn, _, err := websocket.DefaultDialer.Dial(
+					fmt.Sprintf("ws://%s/builds/%s/log/output", server.Listener.Addr().String(), build.Guid),
+					nil,
+				)
 				Ω(err).ShouldNot(HaveOccurred())
 
-				Ω(response.StatusCode).Should(Equal(http.StatusOK))
+				putResult(build.Guid, "succeeded")
 
-				var result builds.BuildResult
-				err = json.NewDecoder(response.Body).Decode(&result)
-				Ω(err).ShouldNot(HaveOccurred())
+				Eventually(drained).Should(BeClosed())
 
-				Ω(result.Status).Should(Equal("succeeded"))
+				var msg interface{}
+				err = outConn.ReadJSON(&msg)
+				Ω(err).Should(HaveOccurred())
 			})
 		})
+	})
 
-		Context("with an invalid build guid", func() {
-			It("returns 404", func() {
-				Ω(response.StatusCode).Should(Equal(http.StatusNotFound))
-			})
+	Describe("GET /healthz", func() {
+		It("returns 200", func() {
+			response, err := client.Get(server.URL + "/healthz")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(response.StatusCode).Should(Equal(http.StatusOK))
 		})
 	})
 
-	Describe("/builds/:guid/log/input", func() {
-		var build builds.Build
-		var endpoint string
+	Describe("GET /readyz", func() {
+		var response *http.Response
+		var status map[string]interface{}
 
-		var conn *websocket.Conn
+		JustBeforeEach(func() {
+			var err error
 
-		BeforeEach(func() {
-			build = builds.Build{
-				Guid: "some-guid",
-			}
+			response, err = client.Get(server.URL + "/readyz")
+			Ω(err).ShouldNot(HaveOccurred())
 
-			endpoint = fmt.Sprintf(
-				"ws://%s/builds/%s/log/input",
-				server.Listener.Addr().String(),
-				build.Guid,
-			)
+			status = nil
+			err = json.NewDecoder(response.Body).Decode(&status)
+			Ω(err).ShouldNot(HaveOccurred())
 		})
 
-		Context("with a valid build guid", func() {
+		Context("when turbine is reachable and the store is writable", func() {
 			BeforeEach(func() {
-				build = createBuild(
-					builds.Build{
-						Config: TurbineBuilds.Config{
-							Image: "ubuntu",
-						},
-					},
-				)
+				turbineServer.AllowUnhandledRequests = true
+				turbineServer.UnhandledRequestStatusCode = http.StatusNotFound
+			})
 
-				endpoint = fmt.Sprintf(
-					"ws://%s/builds/%s/log/input",
-					server.Listener.Addr().String(),
-					build.Guid,
-				)
+			It("returns 200", func() {
+				Ω(response.StatusCode).Should(Equal(http.StatusOK))
+				Ω(status["status"]).Should(Equal("ready"))
 			})
 
-			Context("when messages are written", func() {
+			Context("but the store is failing", func() {
 				BeforeEach(func() {
-					var err error
-
-					conn, _, err = websocket.DefaultDialer.Dial(endpoint, nil)
-					Ω(err).ShouldNot(HaveOccurred())
-
-					err = conn.WriteJSON("hello1")
-					Ω(err).ShouldNot(HaveOccurred())
-
-					err = conn.WriteJSON("hello2")
-					Ω(err).ShouldNot(HaveOccurred())
-
-					err = conn.WriteJSON("hello3")
-					Ω(err).ShouldNot(HaveOccurred())
+					buildStore = brokenStore{buildStore}
+					reserve()
 				})
 
-				AfterEach(func() {
-					conn.Close()
+				It("returns 503 with the store's error", func() {
+					Ω(response.StatusCode).Should(Equal(http.StatusServiceUnavailable))
+					Ω(status["checks"]).Should(HaveKeyWithValue("store", map[string]interface{}{
+						"ok":    false,
+						"error": "disk full",
+					}))
 				})
+			})
+		})
 
-				outputSink := func() <-chan interface{} {
-					outEndpoint := fmt.Sprintf(
-						"ws://%s/builds/%s/log/output",
-						server.Listener.Addr().String(),
-						build.Guid,
-					)
-
-					outConn, _, err := websocket.DefaultDialer.Dial(outEndpoint, nil)
-					Ω(err).ShouldNot(HaveOccurred())
-
-					messages := make(chan interface{})
-
-					go func() {
-						for {
-							var msg interface{}
-							err := outConn.ReadJSON(&msg)
-							if err != nil {
-								break
-							}
-
-							messages <- msg
-						}
-					}()
+		Context("when turbine is unreachable", func() {
+			BeforeEach(func() {
+				turbineServer.Close()
+			})
 
-					return messages
-				}
+			It("returns 503 with turbine's error", func() {
+				Ω(response.StatusCode).Should(Equal(http.StatusServiceUnavailable))
+				Ω(status["status"]).Should(Equal("not ready"))
+				Ω(status["checks"]).Should(HaveKeyWithValue("turbine", HaveKeyWithValue("ok", false)))
+				Ω(status["checks"]).Should(HaveKeyWithValue("store", HaveKeyWithValue("ok", true)))
+			})
+		})
+	})
+})
 
-				It("presents them to /builds/{guid}/logs/output", func() {
-					sink := outputSink()
-					Eventually(sink).Should(Receive(Equal("hello1")))
-					Eventually(sink).Should(Receive(Equal("hello2")))
-					Eventually(sink).Should(Receive(Equal("hello3")))
-				})
+type brokenStore struct {
+	store.Store
+}
 
-				It("streams them to all open connections to /build/{guid}/logs/output", func() {
-					sink1 := outputSink()
-					sink2 := outputSink()
+func (brokenStore) Check() error {
+	return errors.New("disk full")
+}
 
-					msg := "hello4"
+type basicAuthRoundTripper struct {
+	username string
+	password string
+}
 
-					err := conn.WriteJSON(msg)
-					Ω(err).ShouldNot(HaveOccurred())
+func basicAuthTransport(username string, password string) http.RoundTripper {
+	return basicAuthRoundTripper{username, password}
+}
 
-					Eventually(sink1).Should(Receive(Equal(msg)))
-					Eventually(sink2).Should(Receive(Equal(msg)))
-				})
-			})
-		})
-	})
-})
+func (transport basicAuthRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	r.SetBasicAuth(transport.username, transport.password)
+	return http.DefaultTransport.RoundTrip(r)
+}
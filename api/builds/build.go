@@ -7,15 +7,86 @@ import (
 )
 
 type Build struct {
-	Guid      string        `json:"guid,omitempty"`
-	Name      string        `json:"name"`
-	CreatedAt time.Time     `json:"created_at,omitempty"`
-	Config    builds.Config `json:"config"`
-	Status    string        `json:"status,omitempty"`
-	HijackURL string        `json:"-"`
-	AbortURL  string        `json:"-"`
+	Guid           string            `json:"guid,omitempty"`
+	Name           string            `json:"name"`
+	Team           string            `json:"team,omitempty"`
+	CreatedBy      string            `json:"created_by,omitempty"`
+	CreatedAt      time.Time         `json:"created_at,omitempty"`
+	Config         builds.Config     `json:"config"`
+	SecretParams   []string          `json:"secret_params,omitempty"`
+	Privileged     bool              `json:"privileged"`
+	Labels         map[string]string `json:"labels,omitempty"`
+	Template       string            `json:"template,omitempty"`
+	TemplateParams map[string]string `json:"template_params,omitempty"`
+	Status         string            `json:"status,omitempty"`
+	Notify         []string          `json:"notify,omitempty"`
+	FinishedAt     time.Time         `json:"finished_at,omitempty"`
+	ExitStatus     *int              `json:"exit_status,omitempty"`
+	Error          string            `json:"error,omitempty"`
+	AbortedBy      string            `json:"aborted_by,omitempty"`
+	AbortReason    string            `json:"abort_reason,omitempty"`
+	HijackURL      string            `json:"-"`
+	AbortURL       string            `json:"-"`
 }
 
 type BuildResult struct {
-	Status string `json:"status"`
+	Status     string    `json:"status"`
+	FinishedAt time.Time `json:"finished_at,omitempty"`
+
+	// the exit status of the build's script, if it ran to completion
+	ExitStatus *int `json:"exit_status,omitempty"`
+
+	// why the build errored, e.g. the image could not be fetched
+	Error string `json:"error,omitempty"`
+}
+
+// AbortRequest is the optional body of a request to abort a build.
+type AbortRequest struct {
+	Reason string `json:"reason"`
+}
+
+// Validation reports every problem that would stop a build from being
+// created, without creating it.
+type Validation struct {
+	Valid bool `json:"valid"`
+
+	// problems with the build itself
+	Invalid []Problem `json:"invalid"`
+
+	// policy rules the build would violate
+	Denied []Problem `json:"denied"`
+}
+
+type Problem struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// BulkResult reports what a bulk operation did, or in a dry run would do, to
+// one of the builds matching its filters.
+type BulkResult struct {
+	Guid   string `json:"guid"`
+	Name   string `json:"name"`
+	Status string `json:"status,omitempty"`
+
+	// why the operation failed, or would fail, for this build
+	Error *Error `json:"error,omitempty"`
+}
+
+const (
+	StatusStarted   = "started"
+	StatusSucceeded = "succeeded"
+	StatusFailed    = "failed"
+	StatusErrored   = "errored"
+	StatusAborted   = "aborted"
+)
+
+// Finished returns true if the build has reached a terminal status.
+func (build Build) Finished() bool {
+	switch build.Status {
+	case StatusSucceeded, StatusFailed, StatusErrored, StatusAborted:
+		return true
+	default:
+		return false
+	}
 }
@@ -0,0 +1,40 @@
+package builds
+
+const (
+	ErrorMalformedRequest  = "malformed_request"
+	ErrorInvalidBuild      = "invalid_build"
+	ErrorPolicyViolation   = "policy_violation"
+	ErrorUnauthorized      = "unauthorized"
+	ErrorForbidden         = "forbidden"
+	ErrorDraining          = "draining"
+	ErrorBuildNotFound     = "build_not_found"
+	ErrorBuildFinished     = "build_finished"
+	ErrorBuildNotFinished  = "build_not_finished"
+	ErrorBitsNotFound      = "bits_not_found"
+	ErrorHijackNotFound    = "hijack_not_found"
+	ErrorRecordingNotFound = "recording_not_found"
+	ErrorTemplateNotFound  = "template_not_found"
+	ErrorTooManyHijacks    = "too_many_hijacks"
+	ErrorQuotaExceeded     = "quota_exceeded"
+	ErrorRateLimited       = "rate_limited"
+	ErrorTurbineFailed     = "turbine_failed"
+	ErrorTurbineRejected   = "turbine_rejected"
+	ErrorHandshakeFailed   = "handshake_failed"
+	ErrorInternal          = "internal_error"
+)
+
+type ErrorResponse struct {
+	Error Error `json:"error"`
+}
+
+type Error struct {
+	Code    string      `json:"code"`
+	Message string      `json:"message"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+// UpstreamDetails describe a failed request to turbine.
+type UpstreamDetails struct {
+	Status int    `json:"upstream_status"`
+	Body   string `json:"upstream_body,omitempty"`
+}
@@ -0,0 +1,74 @@
+package builds
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// HijackFrame is a single message exchanged over a websocket hijack session.
+type HijackFrame struct {
+	Type string `json:"type"`
+
+	// the process to run; sent once by the client to start the session
+	Spec json.RawMessage `json:"spec,omitempty"`
+
+	// stdin or stdout data
+	Data []byte `json:"data,omitempty"`
+
+	// why the session failed
+	Message string `json:"message,omitempty"`
+}
+
+const (
+	// sent by the client
+	HijackFrameSpec       = "spec"
+	HijackFrameStdin      = "stdin"
+	HijackFrameCloseStdin = "close_stdin"
+
+	// sent by glider; turbine relays the process's TTY as a single stream, so
+	// there is no separate stderr, and exit only marks the end of output
+	HijackFrameStdout = "stdout"
+	HijackFrameExit   = "exit"
+	HijackFrameError  = "error"
+)
+
+// HijackSession is the audit record of a process run in a build's container.
+type HijackSession struct {
+	ID    string `json:"id"`
+	Build string `json:"build"`
+
+	// who hijacked the build
+	User string `json:"user,omitempty"`
+	Team string `json:"team,omitempty"`
+
+	StartedAt time.Time `json:"started_at"`
+	EndedAt   time.Time `json:"ended_at,omitempty"`
+
+	// how long the session lasted, in seconds; set once it has ended
+	Duration float64 `json:"duration,omitempty"`
+
+	// whether a transcript of the session is available
+	Recorded bool `json:"recorded"`
+
+	// whether the transcript stops short, for reaching the maximum size
+	Truncated bool `json:"truncated,omitempty"`
+
+	// whether the session is still in progress; determined when listing
+	// sessions rather than stored
+	Active bool `json:"active"`
+}
+
+// HijackSessionsByStartedAt sorts hijack sessions, oldest first.
+type HijackSessionsByStartedAt []HijackSession
+
+func (sessions HijackSessionsByStartedAt) Len() int {
+	return len(sessions)
+}
+
+func (sessions HijackSessionsByStartedAt) Less(i, j int) bool {
+	return sessions[i].StartedAt.Before(sessions[j].StartedAt)
+}
+
+func (sessions HijackSessionsByStartedAt) Swap(i, j int) {
+	sessions[i], sessions[j] = sessions[j], sessions[i]
+}
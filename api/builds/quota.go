@@ -0,0 +1,44 @@
+package builds
+
+// QuotaLimits cap what a team or user may use. Zero means no limit.
+type QuotaLimits struct {
+	ConcurrentBuilds int   `json:"concurrent_builds,omitempty"`
+	BuildsPerHour    int   `json:"builds_per_hour,omitempty"`
+	MaxBitsSize      int64 `json:"max_bits_size,omitempty"`
+	LogBytes         int64 `json:"log_bytes,omitempty"`
+}
+
+// QuotaUsage is what a team or user is currently using.
+type QuotaUsage struct {
+	// builds that have not yet finished
+	ConcurrentBuilds int `json:"concurrent_builds"`
+
+	// builds created within the past hour
+	BuildsLastHour int `json:"builds_last_hour"`
+
+	// bytes held in the logs of every build still in glider
+	LogBytes int64 `json:"log_bytes"`
+}
+
+type Quota struct {
+	Name   string      `json:"name"`
+	Limits QuotaLimits `json:"limits"`
+	Usage  QuotaUsage  `json:"usage"`
+}
+
+// Quotas are the limits and usage of the caller and their team.
+type Quotas struct {
+	User Quota `json:"user"`
+	Team Quota `json:"team"`
+}
+
+// QuotaDetails describe the quota that a request would exceed.
+type QuotaDetails struct {
+	// "user" or "team"
+	Scope string `json:"scope"`
+	Name  string `json:"name"`
+
+	// as named in QuotaLimits, e.g. "concurrent_builds"
+	Quota string `json:"quota"`
+	Limit int64  `json:"limit"`
+}
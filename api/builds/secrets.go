@@ -0,0 +1,75 @@
+package builds
+
+import "strings"
+
+// RedactedValue replaces the values of secret params wherever builds are
+// shown to users or logged.
+const RedactedValue = "[redacted]"
+
+// secretParamMarkers are the parts of param names that make them secret by
+// convention, e.g. GITHUB_TOKEN or aws_secret_access_key.
+var secretParamMarkers = []string{
+	"SECRET",
+	"TOKEN",
+	"PASSWORD",
+	"PASSWD",
+	"PRIVATE_KEY",
+	"API_KEY",
+	"ACCESS_KEY",
+	"CREDENTIAL",
+}
+
+// IsSecretParam returns true if the param is listed in the build's
+// SecretParams or is named like a secret.
+func (build Build) IsSecretParam(name string) bool {
+	for _, secret := range build.SecretParams {
+		if secret == name {
+			return true
+		}
+	}
+
+	upper := strings.ToUpper(name)
+
+	for _, marker := range secretParamMarkers {
+		if strings.Contains(upper, marker) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SecretValues returns the non-empty values of the build's secret params.
+func (build Build) SecretValues() []string {
+	values := []string{}
+
+	for name, value := range build.Config.Params {
+		if value != "" && build.IsSecretParam(name) {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// Redacted returns a copy of the build with the values of its secret params
+// replaced, fit for showing to users and logging.
+func (build Build) Redacted() Build {
+	if len(build.Config.Params) == 0 {
+		return build
+	}
+
+	params := make(map[string]string, len(build.Config.Params))
+
+	for name, value := range build.Config.Params {
+		if build.IsSecretParam(name) {
+			params[name] = RedactedValue
+		} else {
+			params[name] = value
+		}
+	}
+
+	build.Config.Params = params
+
+	return build
+}
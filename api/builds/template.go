@@ -0,0 +1,35 @@
+package builds
+
+import (
+	"time"
+
+	"github.com/concourse/turbine/api/builds"
+)
+
+// Template is a build config kept by glider for a team to create builds from.
+// Its config may contain ((name)) placeholders, which each build fills in
+// from its template params.
+type Template struct {
+	Name         string        `json:"name"`
+	Team         string        `json:"team,omitempty"`
+	Config       builds.Config `json:"config"`
+	SecretParams []string      `json:"secret_params,omitempty"`
+
+	// the names of the placeholders in the config, which every build created
+	// from the template must fill in
+	Placeholders []string `json:"placeholders"`
+
+	UpdatedBy string    `json:"updated_by,omitempty"`
+	UpdatedAt time.Time `json:"updated_at,omitempty"`
+}
+
+// Redacted returns a copy of the template with the values of its secret
+// params replaced, as with Build.Redacted.
+func (template Template) Redacted() Template {
+	template.Config = Build{
+		Config:       template.Config,
+		SecretParams: template.SecretParams,
+	}.Redacted().Config
+
+	return template
+}
@@ -1,11 +1,23 @@
 package handler
 
 import (
+	"encoding/json"
+	"io"
 	"net/http"
+	"time"
 
 	"github.com/pivotal-golang/lager"
+
+	"github.com/concourse/glider/api/builds"
+	"github.com/concourse/glider/auth"
+	"github.com/concourse/glider/events"
+	"github.com/concourse/glider/metrics"
+	"github.com/concourse/glider/webhooks"
 )
 
+// AbortBuild aborts the build at whatever stage it is in. Builds that turbine
+// has not yet accepted, including those whose bits are still being uploaded,
+// are aborted locally; otherwise the abort is forwarded to turbine.
 func (handler *Handler) AbortBuild(w http.ResponseWriter, r *http.Request) {
 	guid := r.FormValue(":guid")
 
@@ -13,44 +25,132 @@ func (handler *Handler) AbortBuild(w http.ResponseWriter, r *http.Request) {
 		"guid": guid,
 	})
 
-	handler.buildsMutex.RLock()
-	build, found := handler.builds[guid]
-	handler.buildsMutex.RUnlock()
+	build, found := handler.lookupBuild(r, guid)
 
 	if !found {
 		log.Info("build-not-found")
-		w.WriteHeader(http.StatusNotFound)
+		writeBuildNotFound(w, guid)
+		return
+	}
+
+	var abort builds.AbortRequest
+	err := json.NewDecoder(r.Body).Decode(&abort)
+	if err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, builds.ErrorMalformedRequest, "malformed abort request: "+err.Error(), nil)
 		return
 	}
 
+	abortErr := handler.abort(log, build, auth.IdentityFrom(r).User, abort.Reason)
+	if abortErr != nil {
+		writeRequestError(w, abortErr)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+}
+
+// abort carries out an abort of the build, either locally or in turbine.
+func (handler *Handler) abort(log lager.Logger, build *builds.Build, abortedBy string, reason string) *requestError {
 	log.Info("aborting", lager.Data{
-		"build": build,
+		"build":  build.Redacted(),
+		"by":     abortedBy,
+		"reason": reason,
 	})
 
-	req, err := http.NewRequest(r.Method, build.AbortURL, r.Body)
-	if err != nil {
-		log.Error("failed-to-create-request", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+	handler.bitsMutex.RLock()
+	bitsSession := handler.bits[build.Guid]
+	handler.bitsMutex.RUnlock()
+
+	handler.logsMutex.RLock()
+	logBuffer := handler.logs[build.Guid]
+	handler.logsMutex.RUnlock()
+
+	handler.buildsMutex.Lock()
+
+	if build.Finished() {
+		handler.buildsMutex.Unlock()
+		return buildFinishedError()
 	}
 
-	resp, err := http.DefaultClient.Do(req)
-	if err != nil {
-		log.Error("failed-to-abort", err)
-		w.WriteHeader(http.StatusInternalServerError)
-		return
+	abortURL := build.AbortURL
+
+	// turbine has not accepted the build yet, so there is nothing to forward
+	// the abort to; cancel it here before it gets there
+	if abortURL == "" {
+		markAborted(build, abortedBy, reason)
 	}
 
-	if resp.StatusCode != http.StatusOK {
-		log.Info("bad-abort-response", lager.Data{
-			"status": resp.Status,
-		})
+	handler.buildsMutex.Unlock()
 
-		resp.Write(w)
-		return
+	if abortURL == "" {
+		close(bitsSession.aborted)
+
+		// turbine will never stream the build's log, so end it now
+		logBuffer.Close()
+	} else {
+		resp, err := handler.abortInTurbine(abortURL)
+		if err != nil {
+			log.Error("failed-to-abort", err)
+			return turbineError("failed to abort build", err)
+		}
+
+		defer resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			log.Info("bad-abort-response", lager.Data{
+				"status": resp.Status,
+			})
+
+			return upstreamError(resp.StatusCode, resp)
+		}
+
+		handler.buildsMutex.Lock()
+		markAborted(build, abortedBy, reason)
+		handler.buildsMutex.Unlock()
 	}
 
-	w.WriteHeader(http.StatusOK)
+	handler.finishAborted(log, build)
 
 	log.Info("aborted")
+
+	return nil
+}
+
+// markAborted must be called with the builds mutex held.
+func markAborted(build *builds.Build, abortedBy string, reason string) {
+	build.Status = builds.StatusAborted
+	build.FinishedAt = time.Now()
+	build.AbortedBy = abortedBy
+	build.AbortReason = reason
+}
+
+// finishAborted wraps up a build that has just been aborted.
+func (handler *Handler) finishAborted(log lager.Logger, build *builds.Build) {
+	handler.finish(build.Guid)
+	handler.terminateHijacks(log, build.Guid)
+
+	handler.saveBuild(log, build)
+	handler.publish(events.Aborted, build)
+	handler.notify(webhooks.EventFinished, build)
+
+	handler.countStatus(build, builds.StatusAborted)
+}
+
+func (handler *Handler) abortInTurbine(abortURL string) (*http.Response, error) {
+	req, err := http.NewRequest("POST", abortURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	startedAt := time.Now()
+
+	resp, err := http.DefaultClient.Do(req)
+
+	metrics.TurbineRequestDuration.Observe(time.Since(startedAt).Seconds(), "abort")
+
+	if err != nil || resp.StatusCode != http.StatusOK {
+		metrics.TurbineErrors.Inc("abort")
+	}
+
+	return resp, err
 }
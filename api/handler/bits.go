@@ -2,11 +2,18 @@ package handler
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
+	"sync/atomic"
 	"time"
 
+	gliderbuilds "github.com/concourse/glider/api/builds"
+	"github.com/concourse/glider/events"
+	"github.com/concourse/glider/metrics"
+	"github.com/concourse/glider/webhooks"
 	"github.com/concourse/turbine/api/builds"
 	"github.com/pivotal-golang/lager"
 )
@@ -14,29 +21,79 @@ import (
 func (handler *Handler) UploadBits(w http.ResponseWriter, r *http.Request) {
 	guid := r.FormValue(":guid")
 
+	build, found := handler.lookupBuild(r, guid)
+	if !found {
+		writeBuildNotFound(w, guid)
+		return
+	}
+
 	handler.buildsMutex.RLock()
-	build, found := handler.builds[guid]
+	finished := build.Finished()
 	handler.buildsMutex.RUnlock()
 
-	if !found {
-		w.WriteHeader(http.StatusNotFound)
+	if finished {
+		writeError(w, http.StatusConflict, gliderbuilds.ErrorBuildFinished, "build has already finished", nil)
 		return
 	}
 
+	maxBits, limiting := handler.maxBitsSize(build)
+	if maxBits > 0 {
+		if r.ContentLength > maxBits {
+			message := fmt.Sprintf("bits are %d bytes; %s '%s' may upload at most %d", r.ContentLength, limiting.Scope, limiting.Name, maxBits)
+			writeQuotaExceeded(w, http.StatusRequestEntityTooLarge, message, limiting)
+			return
+		}
+
+		// turbine accepts the build before fetching the bits, so an upload of
+		// unknown length could only be cut off once it is too late to refuse
+		if r.ContentLength < 0 {
+			message := fmt.Sprintf("bits must have a Content-Length; %s '%s' may upload at most %d bytes", limiting.Scope, limiting.Name, maxBits)
+			writeQuotaExceeded(w, http.StatusLengthRequired, message, limiting)
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxBits)
+	}
+
 	log := handler.logger.Session("upload", lager.Data{
-		"build": build,
+		"build": build.Redacted(),
 	})
 
+	handler.bitsMutex.RLock()
+	session := handler.bits[guid]
+	handler.bitsMutex.RUnlock()
+
+	atomic.AddInt32(&handler.activeUploads, 1)
+	defer atomic.AddInt32(&handler.activeUploads, -1)
+
+	// checked only once the upload is counted, so that a drain either waits
+	// for it or it is refused
+	if handler.drainer.IsDraining() {
+		writeError(w, http.StatusServiceUnavailable, gliderbuilds.ErrorDraining, "glider is draining; no new uploads are being accepted", nil)
+		return
+	}
+
 	log.Info("triggering")
 
+	startedAt := time.Now()
+
+	// secret params are only decrypted to hand to turbine here, to redact
+	// them from the log, and to re-encrypt them on restore
+	unsealed, err := handler.unsealSecrets(*build)
+	if err != nil {
+		log.Error("failed-to-decrypt-secrets", err)
+		writeInternalError(w, err)
+		return
+	}
+
 	buf := new(bytes.Buffer)
 
 	turbineBuild := builds.Build{
 		Guid: build.Guid,
 
-		Privileged: true,
+		Privileged: build.Privileged,
 
-		Config: build.Config,
+		Config: unsealed.Config,
 
 		Inputs: []builds.Input{
 			{
@@ -52,17 +109,48 @@ func (handler *Handler) UploadBits(w http.ResponseWriter, r *http.Request) {
 		EventsCallback: "ws://" + handler.peerAddr + "/builds/" + build.Guid + "/log/input",
 	}
 
-	err := json.NewEncoder(buf).Encode(turbineBuild)
+	err = json.NewEncoder(buf).Encode(turbineBuild)
 	if err != nil {
 		panic(err)
 	}
 
 	defer r.Body.Close()
 
-	res, err := http.Post(handler.turbineURL+"/builds", "application/json", buf)
+	// give up on triggering the build if it is aborted in the meantime
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go func() {
+		select {
+		case <-session.aborted:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	req, err := http.NewRequest("POST", handler.turbineURL+"/builds", buf)
+	if err != nil {
+		panic(err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := http.DefaultClient.Do(req.WithContext(ctx))
+
+	metrics.TurbineRequestDuration.Observe(time.Since(startedAt).Seconds(), "trigger")
+
 	if err != nil {
+		select {
+		case <-session.aborted:
+			log.Info("aborted")
+			writeError(w, http.StatusConflict, gliderbuilds.ErrorBuildFinished, "build was aborted", nil)
+			return
+		default:
+		}
+
+		metrics.TurbineErrors.Inc("trigger")
 		log.Error("failed-to-trigger", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeTurbineError(w, "failed to trigger build", err)
 		return
 	}
 
@@ -73,29 +161,52 @@ func (handler *Handler) UploadBits(w http.ResponseWriter, r *http.Request) {
 		err := json.NewDecoder(res.Body).Decode(&tbuild)
 		if err != nil {
 			log.Error("failed-to-parse-build", err)
-			w.WriteHeader(http.StatusInternalServerError)
+			writeTurbineError(w, "failed to parse turbine's response", err)
 			return
 		}
 
-		w.WriteHeader(http.StatusCreated)
-
 		handler.buildsMutex.Lock()
-		build.HijackURL = tbuild.HijackURL
-		build.AbortURL = tbuild.AbortURL
+		aborted := build.Status == gliderbuilds.StatusAborted
+		if !aborted {
+			build.HijackURL = tbuild.HijackURL
+			build.AbortURL = tbuild.AbortURL
+		}
 		handler.buildsMutex.Unlock()
 
-		handler.bitsMutex.RLock()
-		session := handler.bits[guid]
-		handler.bitsMutex.RUnlock()
+		// the build was aborted while turbine was accepting it
+		if aborted {
+			log.Info("aborting-in-turbine")
+
+			resp, err := handler.abortInTurbine(tbuild.AbortURL)
+			if err != nil {
+				log.Error("failed-to-abort", err)
+			} else {
+				resp.Body.Close()
+			}
+
+			writeError(w, http.StatusConflict, gliderbuilds.ErrorBuildFinished, "build was aborted", nil)
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+
+		handler.saveBuild(log, build)
+		handler.notify(webhooks.EventTriggered, build)
+		handler.publish(events.Triggered, build)
 
 		session.servingBits.Add(1)
 		session.bits <- r
 		session.servingBits.Wait()
+
+		metrics.UploadDuration.Observe(time.Since(startedAt).Seconds())
 	} else {
+		metrics.TurbineErrors.Inc("trigger")
+
 		log.Info("bad-status-code", lager.Data{
 			"status": res.Status,
 		})
-		w.WriteHeader(http.StatusServiceUnavailable)
+
+		writeUpstreamError(w, http.StatusServiceUnavailable, res)
 	}
 }
 
@@ -107,7 +218,7 @@ func (handler *Handler) DownloadBits(w http.ResponseWriter, r *http.Request) {
 	handler.bitsMutex.RUnlock()
 
 	if !found {
-		w.WriteHeader(http.StatusNotFound)
+		writeBuildNotFound(w, guid)
 		return
 	}
 
@@ -120,7 +231,7 @@ func (handler *Handler) DownloadBits(w http.ResponseWriter, r *http.Request) {
 	select {
 	case bits = <-session.bits:
 	case <-time.After(time.Second):
-		w.WriteHeader(404)
+		writeBitsNotFound(w)
 		return
 	}
 
@@ -132,8 +243,19 @@ func (handler *Handler) DownloadBits(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(200)
 
-	_, err := io.Copy(w, bits.Body)
+	n, err := io.Copy(w, bits.Body)
 	if err != nil {
 		log.Error("failed-to-stream", err)
+		return
+	}
+
+	metrics.UploadBytes.Observe(float64(n))
+
+	handler.buildsMutex.RLock()
+	build, found := handler.builds[guid]
+	handler.buildsMutex.RUnlock()
+
+	if found {
+		handler.publish(events.BitsUploaded, build)
 	}
 }
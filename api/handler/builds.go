@@ -2,9 +2,8 @@ package handler
 
 import (
 	"encoding/json"
-	"errors"
 	"net/http"
-	"sort"
+	"net/url"
 	"sync"
 	"time"
 
@@ -12,20 +11,45 @@ import (
 	"github.com/pivotal-golang/lager"
 
 	"github.com/concourse/glider/api/builds"
+	"github.com/concourse/glider/auth"
+	"github.com/concourse/glider/events"
+	"github.com/concourse/glider/policy"
+	"github.com/concourse/glider/webhooks"
 	"github.com/concourse/logbuffer"
 )
 
 func (handler *Handler) CreateBuild(w http.ResponseWriter, r *http.Request) {
+	if handler.drainer.IsDraining() {
+		writeError(w, http.StatusServiceUnavailable, builds.ErrorDraining, "glider is draining; no new builds are being accepted", nil)
+		return
+	}
+
 	var build builds.Build
 	err := json.NewDecoder(r.Body).Decode(&build)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, builds.ErrorMalformedRequest, "malformed build: "+err.Error(), nil)
 		return
 	}
 
-	err = handler.validateBuild(build)
+	identity := auth.IdentityFrom(r)
+
+	invalid, err := handler.applyTemplate(identity.Team, &build)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		handler.logger.Error("failed-to-apply-template", err)
+		writeInternalError(w, err)
+		return
+	}
+
+	invalid = append(invalid, handler.validateBuild(build)...)
+	denied := handler.policy.Check(identity, build)
+
+	if len(invalid) > 0 {
+		writeError(w, http.StatusBadRequest, builds.ErrorInvalidBuild, "invalid build", append(invalid, denied...))
+		return
+	}
+
+	if len(denied) > 0 {
+		writeError(w, http.StatusForbidden, builds.ErrorPolicyViolation, "build violates policy", denied)
 		return
 	}
 
@@ -35,56 +59,136 @@ func (handler *Handler) CreateBuild(w http.ResponseWriter, r *http.Request) {
 	}
 
 	build.Guid = uuid.String()
+	build.Team = identity.Team
+	build.CreatedBy = identity.User
+
+	// the result is only ever reported by turbine, or recorded by an abort
+	build.Status = ""
+	build.FinishedAt = time.Time{}
+	build.ExitStatus = nil
+	build.Error = ""
+	build.AbortedBy = ""
+	build.AbortReason = ""
+
+	err = handler.sealSecrets(&build)
+	if err != nil {
+		handler.logger.Error("failed-to-encrypt-secrets", err)
+		writeInternalError(w, err)
+		return
+	}
+
+	handler.quotasMutex.Lock()
+
+	exceeded := handler.checkBuildQuotas(identity.User, identity.Team)
+	if exceeded != nil {
+		handler.quotasMutex.Unlock()
+		writeQuotaExceeded(w, http.StatusTooManyRequests, exceeded.Error(), exceeded)
+		return
+	}
+
 	build.CreatedAt = time.Now()
 
 	log := handler.logger.Session("create", lager.Data{
-		"build": build,
+		"build": build.Redacted(),
 	})
 
 	log.Info("register")
 
+	handler.register(&build)
+	handler.recordCreation(&build)
+
+	handler.quotasMutex.Unlock()
+	handler.saveBuild(log, &build)
+	handler.notify(webhooks.EventCreated, &build)
+	handler.publish(events.Created, &build)
+
+	handler.countCreated(&build)
+
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(build.Redacted())
+}
+
+// GetBuilds lists the caller's team's builds matching the query's filters,
+// most recently created first. Admins see every team's builds.
+func (handler *Handler) GetBuilds(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseBuildFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, builds.ErrorMalformedRequest, err.Error(), nil)
+		return
+	}
+
+	matching := handler.matchingBuilds(filter)
+	for i, build := range matching {
+		matching[i] = build.Redacted()
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(matching)
+}
+
+// lookupBuild finds the build, provided the caller may access it. Builds owned
+// by other teams are treated as not found, so as not to reveal them.
+func (handler *Handler) lookupBuild(r *http.Request, guid string) (*builds.Build, bool) {
+	handler.buildsMutex.RLock()
+	build, found := handler.builds[guid]
+	handler.buildsMutex.RUnlock()
+
+	// a build's team never changes, so it can be read without the lock
+	if !found || !auth.IdentityFrom(r).CanAccess(build.Team) {
+		return nil, false
+	}
+
+	return build, true
+}
+
+// register tracks the build, along with sessions for uploading its bits and
+// streaming its logs.
+func (handler *Handler) register(build *builds.Build) *logbuffer.LogBuffer {
+	logBuffer := logbuffer.NewLogBuffer()
+
 	handler.bitsMutex.Lock()
 	handler.bits[build.Guid] = BitsSession{
 		bits:        make(chan *http.Request, 1),
 		servingBits: &sync.WaitGroup{},
+		aborted:     make(chan struct{}),
 	}
 	handler.bitsMutex.Unlock()
 
 	handler.logsMutex.Lock()
-	handler.logs[build.Guid] = logbuffer.NewLogBuffer()
+	handler.logs[build.Guid] = logBuffer
+	handler.logBytes[build.Guid] = new(int64)
 	handler.logsMutex.Unlock()
 
 	handler.buildsMutex.Lock()
-	handler.builds[build.Guid] = &build
+	handler.builds[build.Guid] = build
+	handler.finished[build.Guid] = make(chan struct{})
 	handler.buildsMutex.Unlock()
 
-	w.WriteHeader(http.StatusCreated)
-	json.NewEncoder(w).Encode(build)
+	return logBuffer
 }
 
-func (handler *Handler) GetBuilds(w http.ResponseWriter, r *http.Request) {
-	handler.buildsMutex.RLock()
+func (handler *Handler) validateBuild(build builds.Build) []policy.Violation {
+	violations := []policy.Violation{}
 
-	builds := make([]builds.Build, len(handler.builds))
-
-	i := 0
-	for _, build := range handler.builds {
-		builds[i] = *build
-		i++
+	if build.Config.Image == "" {
+		violations = append(violations, policy.Violation{
+			Rule:    "image",
+			Message: "missing build image",
+		})
 	}
 
-	handler.buildsMutex.RUnlock()
-
-	sort.Sort(sort.Reverse(ByCreatedAt(builds)))
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(builds)
-}
-
-func (handler *Handler) validateBuild(build builds.Build) error {
-	if build.Config.Image == "" {
-		return errors.New("missing build image")
+	for _, notifyURL := range build.Notify {
+		parsed, err := url.Parse(notifyURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			violations = append(violations, policy.Violation{
+				Rule:    "notify",
+				Message: "invalid notify url: " + notifyURL,
+			})
+		}
 	}
 
-	return nil
+	violations = append(violations, validateLabels(build.Labels)...)
+	violations = append(violations, validateSecretParams(build)...)
+
+	return violations
 }
@@ -0,0 +1,183 @@
+package handler
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/concourse/glider/api/builds"
+	"github.com/concourse/glider/auth"
+	"github.com/concourse/glider/events"
+)
+
+// bulkOperation is carried out on each build matching a bulk request's
+// filters. In a dry run it must only check whether it would succeed.
+type bulkOperation func(log lager.Logger, build *builds.Build, dryRun bool) *requestError
+
+// AbortBuilds aborts every build matching the query's filters, as with
+// AbortBuild, and reports the outcome for each. With dry_run=true nothing is
+// aborted.
+func (handler *Handler) AbortBuilds(w http.ResponseWriter, r *http.Request) {
+	var abort builds.AbortRequest
+	err := json.NewDecoder(r.Body).Decode(&abort)
+	if err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, builds.ErrorMalformedRequest, "malformed abort request: "+err.Error(), nil)
+		return
+	}
+
+	abortedBy := auth.IdentityFrom(r).User
+
+	handler.runBulk(w, r, "bulk-abort", func(log lager.Logger, build *builds.Build, dryRun bool) *requestError {
+		if dryRun {
+			handler.buildsMutex.RLock()
+			finished := build.Finished()
+			handler.buildsMutex.RUnlock()
+
+			if finished {
+				return buildFinishedError()
+			}
+
+			return nil
+		}
+
+		return handler.abort(log, build, abortedBy, abort.Reason)
+	})
+}
+
+// DeleteBuilds forgets every finished build matching the query's filters,
+// along with its log, bits and hijack sessions, and reports the outcome for
+// each. With dry_run=true nothing is deleted.
+func (handler *Handler) DeleteBuilds(w http.ResponseWriter, r *http.Request) {
+	handler.runBulk(w, r, "bulk-delete", handler.deleteBuild)
+}
+
+func (handler *Handler) runBulk(w http.ResponseWriter, r *http.Request, session string, operation bulkOperation) {
+	filter, err := parseBuildFilter(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, builds.ErrorMalformedRequest, err.Error(), nil)
+		return
+	}
+
+	// guard against wiping out every build by accident
+	if filter.empty() {
+		writeError(w, http.StatusBadRequest, builds.ErrorMalformedRequest, "bulk operations require at least one filter", nil)
+		return
+	}
+
+	dryRun := r.URL.Query().Get("dry_run") == "true"
+
+	log := handler.logger.Session(session, lager.Data{
+		"query":   r.URL.RawQuery,
+		"by":      auth.IdentityFrom(r).User,
+		"dry-run": dryRun,
+	})
+
+	results := []builds.BulkResult{}
+
+	for _, matched := range handler.matchingBuilds(filter) {
+		result := builds.BulkResult{
+			Guid: matched.Guid,
+			Name: matched.Name,
+		}
+
+		handler.buildsMutex.RLock()
+		build, found := handler.builds[matched.Guid]
+		handler.buildsMutex.RUnlock()
+
+		// deleted since it was matched
+		if !found {
+			result.Status = matched.Status
+			result.Error = &builds.Error{
+				Code:    builds.ErrorBuildNotFound,
+				Message: "build '" + matched.Guid + "' not found",
+			}
+
+			results = append(results, result)
+			continue
+		}
+
+		operationErr := operation(log, build, dryRun)
+		if operationErr != nil {
+			result.Error = &operationErr.body
+		}
+
+		handler.buildsMutex.RLock()
+		result.Status = build.Status
+		handler.buildsMutex.RUnlock()
+
+		results = append(results, result)
+	}
+
+	log.Info("done", lager.Data{
+		"builds": len(results),
+	})
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(results)
+}
+
+// deleteBuild removes a finished build from glider and its store.
+func (handler *Handler) deleteBuild(log lager.Logger, build *builds.Build, dryRun bool) *requestError {
+	handler.buildsMutex.Lock()
+
+	if !build.Finished() {
+		handler.buildsMutex.Unlock()
+		return &requestError{
+			status: http.StatusConflict,
+			body: builds.Error{
+				Code:    builds.ErrorBuildNotFinished,
+				Message: "build has not finished; abort it first",
+			},
+		}
+	}
+
+	if dryRun {
+		handler.buildsMutex.Unlock()
+		return nil
+	}
+
+	delete(handler.builds, build.Guid)
+	delete(handler.finished, build.Guid)
+
+	handler.buildsMutex.Unlock()
+
+	log.Info("deleting", lager.Data{
+		"build": build.Redacted(),
+	})
+
+	handler.logsMutex.Lock()
+	logBuffer := handler.logs[build.Guid]
+	delete(handler.logs, build.Guid)
+	delete(handler.logBytes, build.Guid)
+	handler.logsMutex.Unlock()
+
+	// disconnects anyone still streaming the log; errors if it has already
+	// been closed
+	logBuffer.Close()
+
+	handler.bitsMutex.Lock()
+	delete(handler.bits, build.Guid)
+	handler.bitsMutex.Unlock()
+
+	handler.terminateHijacks(log, build.Guid)
+
+	handler.notifier.Forget(build.Guid)
+
+	err := handler.store.DeleteBuild(build.Guid)
+	if err != nil {
+		log.Error("failed-to-delete-build", err)
+		return &requestError{
+			status: http.StatusInternalServerError,
+			body: builds.Error{
+				Code:    builds.ErrorInternal,
+				Message: err.Error(),
+			},
+		}
+	}
+
+	handler.publish(events.Reaped, build)
+
+	return nil
+}
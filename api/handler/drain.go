@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/concourse/glider/api/builds"
+)
+
+const drainPollInterval = 100 * time.Millisecond
+
+// Drain starts draining the server, as if it had been sent SIGTERM.
+func (handler *Handler) Drain(w http.ResponseWriter, r *http.Request) {
+	handler.logger.Info("drain-requested")
+
+	handler.drainer.Start()
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// DrainBuilds waits until the deadline for in-flight uploads to finish and for
+// turbine to report the result of every running build. It then closes all
+// logs and saves every build.
+func (handler *Handler) DrainBuilds(deadline time.Time) {
+	log := handler.logger.Session("drain")
+
+	log.Info("draining")
+
+	for {
+		uploads := atomic.LoadInt32(&handler.activeUploads)
+		running := handler.runningBuilds()
+
+		if uploads == 0 && running == 0 {
+			break
+		}
+
+		if time.Now().After(deadline) {
+			log.Info("deadline-exceeded", lager.Data{
+				"uploads": uploads,
+				"running": running,
+			})
+
+			break
+		}
+
+		time.Sleep(drainPollInterval)
+	}
+
+	handler.events.Close()
+
+	handler.logsMutex.RLock()
+	for _, logBuffer := range handler.logs {
+		// errors if the log has already been closed
+		logBuffer.Close()
+	}
+	handler.logsMutex.RUnlock()
+
+	handler.buildsMutex.RLock()
+	allBuilds := make([]*builds.Build, 0, len(handler.builds))
+	for _, build := range handler.builds {
+		allBuilds = append(allBuilds, build)
+	}
+	handler.buildsMutex.RUnlock()
+
+	for _, build := range allBuilds {
+		handler.saveBuild(log, build)
+	}
+
+	log.Info("drained")
+}
+
+// runningBuilds counts builds that have been handed to turbine but have not
+// yet finished.
+func (handler *Handler) runningBuilds() int {
+	handler.buildsMutex.RLock()
+	defer handler.buildsMutex.RUnlock()
+
+	running := 0
+	for _, build := range handler.builds {
+		if build.Status == builds.StatusStarted || (build.Status == "" && build.AbortURL != "") {
+			running++
+		}
+	}
+
+	return running
+}
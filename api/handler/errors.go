@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/concourse/glider/api/builds"
+)
+
+// upstream responses are read into error details up to this many bytes
+const maxUpstreamBody = 4096
+
+func writeError(w http.ResponseWriter, status int, code string, message string, details interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(builds.ErrorResponse{
+		Error: builds.Error{
+			Code:    code,
+			Message: message,
+			Details: details,
+		},
+	})
+}
+
+func writeBuildNotFound(w http.ResponseWriter, guid string) {
+	writeError(w, http.StatusNotFound, builds.ErrorBuildNotFound, "build '"+guid+"' not found", nil)
+}
+
+func writeTemplateNotFound(w http.ResponseWriter, name string) {
+	writeError(w, http.StatusNotFound, builds.ErrorTemplateNotFound, "template '"+name+"' not found", nil)
+}
+
+func writeBitsNotFound(w http.ResponseWriter) {
+	writeError(w, http.StatusNotFound, builds.ErrorBitsNotFound, "no bits were uploaded", nil)
+}
+
+func writeTooManyHijacks(w http.ResponseWriter, max int) {
+	writeError(w, http.StatusTooManyRequests, builds.ErrorTooManyHijacks, fmt.Sprintf("build already has %d hijack sessions", max), nil)
+}
+
+func writeInternalError(w http.ResponseWriter, err error) {
+	writeError(w, http.StatusInternalServerError, builds.ErrorInternal, err.Error(), nil)
+}
+
+// writeTurbineError reports a failure to talk to turbine at all.
+func writeTurbineError(w http.ResponseWriter, message string, err error) {
+	writeRequestError(w, turbineError(message, err))
+}
+
+// writeUpstreamError reports a response from turbine that wasn't what we
+// expected, including its status and (truncated) body.
+func writeUpstreamError(w http.ResponseWriter, status int, resp *http.Response) {
+	writeRequestError(w, upstreamError(status, resp))
+}
+
+// requestError is a failure that is destined for the client, for operations
+// whose errors are either written as the response or collected into it.
+type requestError struct {
+	status int
+	body   builds.Error
+}
+
+func (err *requestError) Error() string {
+	return err.body.Message
+}
+
+func writeRequestError(w http.ResponseWriter, err *requestError) {
+	writeError(w, err.status, err.body.Code, err.body.Message, err.body.Details)
+}
+
+func buildFinishedError() *requestError {
+	return &requestError{
+		status: http.StatusConflict,
+		body: builds.Error{
+			Code:    builds.ErrorBuildFinished,
+			Message: "build has already finished",
+		},
+	}
+}
+
+func turbineError(message string, err error) *requestError {
+	return &requestError{
+		status: http.StatusInternalServerError,
+		body: builds.Error{
+			Code:    builds.ErrorTurbineFailed,
+			Message: message + ": " + err.Error(),
+		},
+	}
+}
+
+func upstreamError(status int, resp *http.Response) *requestError {
+	body, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxUpstreamBody))
+
+	return &requestError{
+		status: status,
+		body: builds.Error{
+			Code:    builds.ErrorTurbineRejected,
+			Message: "turbine responded with " + resp.Status,
+			Details: builds.UpstreamDetails{
+				Status: resp.StatusCode,
+				Body:   string(body),
+			},
+		},
+	}
+}
+
+func writeHandshakeError(w http.ResponseWriter, r *http.Request, status int, reason error) {
+	writeError(w, status, builds.ErrorHandshakeFailed, reason.Error(), nil)
+}
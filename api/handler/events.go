@@ -0,0 +1,132 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/concourse/glider/api/builds"
+	"github.com/concourse/glider/auth"
+	"github.com/concourse/glider/events"
+)
+
+// StreamEvents streams the lifecycle events of every build the caller may
+// access, over a websocket if requested and as server-sent events otherwise.
+func (handler *Handler) StreamEvents(w http.ResponseWriter, r *http.Request) {
+	log := handler.logger.Session("events")
+
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		handler.streamEventsOverWebsocket(log, w, r)
+	} else {
+		handler.streamServerSentEvents(log, w, r)
+	}
+}
+
+func (handler *Handler) streamEventsOverWebsocket(log lager.Logger, w http.ResponseWriter, r *http.Request) {
+	// subscribe before upgrading so that the client sees every event
+	// published once the handshake completes
+	identity := auth.IdentityFrom(r)
+
+	stream, unsubscribe := handler.events.Subscribe()
+	defer unsubscribe()
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Error("failed-to-upgrade", err)
+		return
+	}
+
+	defer conn.Close()
+
+	disconnected := make(chan struct{})
+
+	go func() {
+		defer close(disconnected)
+
+		for {
+			_, _, err := conn.NextReader()
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		select {
+		case event, ok := <-stream:
+			if !ok {
+				return
+			}
+
+			if !identity.CanAccess(event.Build.Team) {
+				continue
+			}
+
+			err := conn.WriteJSON(event)
+			if err != nil {
+				return
+			}
+
+		case <-disconnected:
+			return
+		}
+	}
+}
+
+func (handler *Handler) streamServerSentEvents(log lager.Logger, w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeInternalError(w, fmt.Errorf("streaming is not supported"))
+		return
+	}
+
+	identity := auth.IdentityFrom(r)
+
+	stream, unsubscribe := handler.events.Subscribe()
+	defer unsubscribe()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		select {
+		case event, ok := <-stream:
+			if !ok {
+				return
+			}
+
+			if !identity.CanAccess(event.Build.Team) {
+				continue
+			}
+
+			payload, err := json.Marshal(event)
+			if err != nil {
+				log.Error("failed-to-marshal-event", err)
+				return
+			}
+
+			_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event.Type, payload)
+			if err != nil {
+				return
+			}
+
+			flusher.Flush()
+
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+func (handler *Handler) publish(eventType events.Type, build *builds.Build) {
+	handler.buildsMutex.RLock()
+	snapshot := *build
+	handler.buildsMutex.RUnlock()
+
+	handler.events.Publish(eventType, snapshot.Redacted())
+}
@@ -0,0 +1,156 @@
+package handler
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/concourse/glider/api/builds"
+	"github.com/concourse/glider/auth"
+)
+
+// statusPending matches builds that have not yet been given a status by
+// turbine or glider.
+const statusPending = "pending"
+
+var filterableStatuses = map[string]bool{
+	statusPending:          true,
+	builds.StatusStarted:   true,
+	builds.StatusSucceeded: true,
+	builds.StatusFailed:    true,
+	builds.StatusErrored:   true,
+	builds.StatusAborted:   true,
+}
+
+// buildFilter selects builds by the query parameters of GET /builds and the
+// bulk operations, limited to those the caller may access. Zero values match
+// every build.
+type buildFilter struct {
+	identity auth.Identity
+
+	// any of these; comma-separated in the query
+	statuses map[string]bool
+
+	team  string
+	name  string
+	image string
+
+	// every one of these; key=value pairs, comma-separated in the query
+	labels map[string]string
+
+	// only builds created at least this long ago
+	olderThan time.Duration
+}
+
+func parseBuildFilter(r *http.Request) (buildFilter, error) {
+	query := r.URL.Query()
+
+	filter := buildFilter{
+		identity: auth.IdentityFrom(r),
+
+		team:  query.Get("team"),
+		name:  query.Get("name"),
+		image: query.Get("image"),
+	}
+
+	if param := query.Get("status"); param != "" {
+		filter.statuses = make(map[string]bool)
+
+		for _, status := range strings.Split(param, ",") {
+			if !filterableStatuses[status] {
+				return buildFilter{}, fmt.Errorf("unknown status: %s", status)
+			}
+
+			filter.statuses[status] = true
+		}
+	}
+
+	if param := query.Get("labels"); param != "" {
+		labels, err := parseLabelSelector(param)
+		if err != nil {
+			return buildFilter{}, err
+		}
+
+		filter.labels = labels
+	}
+
+	if param := query.Get("older_than"); param != "" {
+		olderThan, err := parseDuration(param)
+		if err != nil {
+			return buildFilter{}, fmt.Errorf("malformed older_than: %s", err)
+		}
+
+		filter.olderThan = olderThan
+	}
+
+	return filter, nil
+}
+
+// empty returns true if the filter matches every build the caller may
+// access.
+func (filter buildFilter) empty() bool {
+	return filter.statuses == nil && filter.team == "" && filter.name == "" && filter.image == "" && filter.labels == nil && filter.olderThan == 0
+}
+
+func (filter buildFilter) matches(build builds.Build, now time.Time) bool {
+	if !filter.identity.CanAccess(build.Team) {
+		return false
+	}
+
+	if filter.team != "" && build.Team != filter.team {
+		return false
+	}
+
+	if filter.statuses != nil {
+		status := build.Status
+		if status == "" {
+			status = statusPending
+		}
+
+		if !filter.statuses[status] {
+			return false
+		}
+	}
+
+	if filter.name != "" && build.Name != filter.name {
+		return false
+	}
+
+	if filter.image != "" && build.Config.Image != filter.image {
+		return false
+	}
+
+	for key, value := range filter.labels {
+		if actual, found := build.Labels[key]; !found || actual != value {
+			return false
+		}
+	}
+
+	if filter.olderThan != 0 && now.Sub(build.CreatedAt) < filter.olderThan {
+		return false
+	}
+
+	return true
+}
+
+// matchingBuilds returns copies of the builds that match the filter, with the
+// most recently created build first.
+func (handler *Handler) matchingBuilds(filter buildFilter) []builds.Build {
+	now := time.Now()
+
+	matching := []builds.Build{}
+
+	handler.buildsMutex.RLock()
+	for _, build := range handler.builds {
+		if filter.matches(*build, now) {
+			matching = append(matching, *build)
+		}
+	}
+	handler.buildsMutex.RUnlock()
+
+	sort.Sort(sort.Reverse(ByCreatedAt(matching)))
+
+	return matching
+}
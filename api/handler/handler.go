@@ -3,8 +3,17 @@ package handler
 import (
 	"net/http"
 	"sync"
+	"time"
 
 	"github.com/concourse/glider/api/builds"
+	"github.com/concourse/glider/drain"
+	"github.com/concourse/glider/events"
+	"github.com/concourse/glider/metrics"
+	"github.com/concourse/glider/policy"
+	"github.com/concourse/glider/quota"
+	"github.com/concourse/glider/secrets"
+	"github.com/concourse/glider/store"
+	"github.com/concourse/glider/webhooks"
 	"github.com/concourse/logbuffer"
 	"github.com/pivotal-golang/lager"
 )
@@ -15,35 +24,175 @@ type Handler struct {
 	peerAddr   string
 	turbineURL string
 
+	policy policy.Policy
+
+	quotas quota.Quotas
+
+	// serializes quota checks with the creation of the builds they admit
+	quotasMutex *sync.Mutex
+
+	// when each user's and team's builds were created within the past hour,
+	// oldest first; kept apart from the builds so that deleting builds does
+	// not free up builds_per_hour, and guarded by quotasMutex
+	userCreations map[string][]time.Time
+	teamCreations map[string][]time.Time
+
+	store store.Store
+
+	// encrypts secret params at rest; nil leaves them in plaintext
+	keyring *secrets.Keyring
+
+	drainer *drain.Drainer
+
+	notifier *webhooks.Notifier
+
+	// build labels to break metrics down by, and their values to count
+	// separately
+	metricLabels metrics.LabelValues
+
+	// whether to keep a transcript of every hijack session
+	recordHijacks bool
+
+	// transcripts stop growing at this many bytes; 0 means no limit
+	maxRecordingSize int
+
+	// how many hijack sessions a build may have at once; 0 means no limit
+	maxHijacksPerBuild int
+
+	// hijack sessions are terminated after going this long without input or
+	// output, or after lasting this long; 0 disables either
+	hijackIdleTimeout time.Duration
+	hijackTimeout     time.Duration
+
+	// how often to ping log websockets; 0 disables keepalives
+	keepaliveInterval time.Duration
+
+	events *events.Hub
+
+	// number of bits uploads in progress; accessed atomically
+	activeUploads int32
+
 	builds      map[string]*builds.Build
 	buildsMutex *sync.RWMutex
 
+	// closed once the corresponding build reaches a terminal status;
+	// guarded by buildsMutex
+	finished map[string]chan struct{}
+
 	logs      map[string]*logbuffer.LogBuffer
 	logsMutex *sync.RWMutex
 
+	// bytes written to each build's log; guarded by logsMutex, with the
+	// counts themselves accessed atomically
+	logBytes map[string]*int64
+
 	bits      map[string]BitsSession
 	bitsMutex *sync.RWMutex
+
+	// active hijack sessions, keyed by build guid and then session id
+	hijacks      map[string]map[string]*hijackSession
+	hijacksMutex *sync.Mutex
+
+	// build templates, keyed by team and then name
+	templates      map[string]map[string]builds.Template
+	templatesMutex *sync.RWMutex
 }
 
 type BitsSession struct {
 	bits        chan *http.Request
 	servingBits *sync.WaitGroup
+
+	// closed if the build is aborted before turbine has accepted it
+	aborted chan struct{}
 }
 
-func NewHandler(logger lager.Logger, peerAddr string, turbineURL string) *Handler {
+// Config is everything a Handler is built from.
+type Config struct {
+	Logger lager.Logger
+
+	// address at which turbine reaches glider's callbacks
+	PeerAddr   string
+	TurbineURL string
+
+	Policy policy.Policy
+	Quotas quota.Quotas
+	Store  store.Store
+
+	// encrypts secret params at rest; nil leaves them in plaintext
+	Keyring *secrets.Keyring
+
+	Drainer  *drain.Drainer
+	Notifier *webhooks.Notifier
+
+	// build labels to break metrics down by, and their values to count
+	// separately
+	MetricLabels metrics.LabelValues
+
+	RecordHijacks bool
+
+	// 0 means no limit
+	MaxRecordingSize   int
+	MaxHijacksPerBuild int
+
+	// 0 disables each
+	HijackIdleTimeout time.Duration
+	HijackTimeout     time.Duration
+	KeepaliveInterval time.Duration
+}
+
+func NewHandler(config Config) *Handler {
 	return &Handler{
-		logger: logger,
+		logger: config.Logger,
+
+		peerAddr:   config.PeerAddr,
+		turbineURL: config.TurbineURL,
+
+		policy: config.Policy,
+
+		quotas:      config.Quotas,
+		quotasMutex: new(sync.Mutex),
+
+		userCreations: make(map[string][]time.Time),
+		teamCreations: make(map[string][]time.Time),
+
+		store: config.Store,
 
-		peerAddr:   peerAddr,
-		turbineURL: turbineURL,
+		keyring: config.Keyring,
+
+		drainer: config.Drainer,
+
+		notifier: config.Notifier,
+
+		metricLabels: config.MetricLabels,
+
+		recordHijacks:      config.RecordHijacks,
+		maxRecordingSize:   config.MaxRecordingSize,
+		maxHijacksPerBuild: config.MaxHijacksPerBuild,
+
+		hijackIdleTimeout: config.HijackIdleTimeout,
+		hijackTimeout:     config.HijackTimeout,
+
+		keepaliveInterval: config.KeepaliveInterval,
+
+		events: events.NewHub(),
 
 		builds:      make(map[string]*builds.Build),
 		buildsMutex: new(sync.RWMutex),
 
+		finished: make(map[string]chan struct{}),
+
 		logs:      make(map[string]*logbuffer.LogBuffer),
 		logsMutex: new(sync.RWMutex),
 
+		logBytes: make(map[string]*int64),
+
 		bits:      make(map[string]BitsSession),
 		bitsMutex: new(sync.RWMutex),
+
+		hijacks:      make(map[string]map[string]*hijackSession),
+		hijacksMutex: new(sync.Mutex),
+
+		templates:      make(map[string]map[string]builds.Template),
+		templatesMutex: new(sync.RWMutex),
 	}
 }
@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+const turbineCheckTimeout = 5 * time.Second
+
+type healthCheck struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error,omitempty"`
+}
+
+type healthStatus struct {
+	Status string                 `json:"status"`
+	Checks map[string]healthCheck `json:"checks,omitempty"`
+}
+
+var errDraining = errors.New("draining")
+
+// Healthz reports that the process is up and serving requests.
+func (handler *Handler) Healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(healthStatus{Status: "alive"})
+}
+
+// Readyz reports whether glider can accept new builds: its store must be
+// writable, turbine must be reachable, and it must not be draining.
+func (handler *Handler) Readyz(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]healthCheck{
+		"store":    newHealthCheck(handler.store.Check()),
+		"turbine":  newHealthCheck(handler.checkTurbine()),
+		"draining": newHealthCheck(handler.checkDraining()),
+	}
+
+	status := http.StatusOK
+	response := healthStatus{
+		Status: "ready",
+		Checks: checks,
+	}
+
+	for _, check := range checks {
+		if !check.OK {
+			status = http.StatusServiceUnavailable
+			response.Status = "not ready"
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(response)
+}
+
+// checkTurbine succeeds if turbine responds at all.
+func (handler *Handler) checkTurbine() error {
+	client := &http.Client{
+		Timeout: turbineCheckTimeout,
+	}
+
+	resp, err := client.Get(handler.turbineURL)
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close()
+
+	return nil
+}
+
+func (handler *Handler) checkDraining() error {
+	if handler.drainer.IsDraining() {
+		return errDraining
+	}
+
+	return nil
+}
+
+func newHealthCheck(err error) healthCheck {
+	if err != nil {
+		return healthCheck{OK: false, Error: err.Error()}
+	}
+
+	return healthCheck{OK: true}
+}
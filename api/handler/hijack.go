@@ -1,61 +1,161 @@
 package handler
 
 import (
+	"bufio"
+	"bytes"
 	"io"
+	"io/ioutil"
+	"time"
 
 	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 
+	"github.com/gorilla/websocket"
 	"github.com/pivotal-golang/lager"
+
+	"github.com/concourse/glider/api/builds"
+	"github.com/concourse/glider/metrics"
 )
 
 func (handler *Handler) HijackBuild(w http.ResponseWriter, r *http.Request) {
 	guid := r.FormValue(":guid")
 
-	handler.buildsMutex.RLock()
-	build, found := handler.builds[guid]
-	handler.buildsMutex.RUnlock()
+	build, found := handler.lookupBuild(r, guid)
 
 	if !found {
-		w.WriteHeader(http.StatusNotFound)
+		writeBuildNotFound(w, guid)
 		return
 	}
 
 	log := handler.logger.Session("hijack", lager.Data{
-		"build": build,
+		"build": build.Redacted(),
 	})
 
 	log.Info("hijacking")
 
-	hijackURL, err := url.Parse(build.HijackURL)
+	session, err := handler.reserveHijack(r, build)
 	if err != nil {
-		log.Error("failed-to-parse-url", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeTooManyHijacks(w, handler.maxHijacksPerBuild)
 		return
 	}
 
-	conn, err := net.Dial("tcp", hijackURL.Host)
+	defer handler.releaseHijack(session)
+
+	client, resp, err := handler.hijackTurbine(build, r.Method, r.Body)
 	if err != nil {
-		log.Error("failed-to-dial-turbine", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		log.Error("failed-to-hijack", err)
+		writeTurbineError(w, "failed to hijack build", err)
 		return
 	}
 
-	req, err := http.NewRequest(r.Method, build.HijackURL, r.Body)
+	if resp.StatusCode != http.StatusOK {
+		log.Info("bad-hijack-response", lager.Data{
+			"status": resp.Status,
+		})
+
+		writeUpstreamError(w, resp.StatusCode, resp)
+		resp.Body.Close()
+		client.Close()
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+
+	sconn, sbr, err := w.(http.Hijacker).Hijack()
 	if err != nil {
-		log.Error("failed-to-create-request", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		log.Error("failed-to-hijack", err)
 		return
 	}
 
-	client := httputil.NewClientConn(conn, nil)
+	cconn, cbr := client.Hijack()
 
-	resp, err := client.Do(req)
+	defer cconn.Close()
+	defer sconn.Close()
+
+	session.attach(cconn)
+	session.attach(sconn)
+
+	log.Info("hijacked")
+
+	metrics.HijackSessions.Inc()
+	defer metrics.HijackSessions.Dec()
+
+	handler.startHijack(log, session)
+	defer handler.endHijack(log, session)
+
+	stopTimeouts := handler.enforceTimeouts(log, session)
+	defer stopTimeouts()
+
+	go io.Copy(cconn, io.TeeReader(sbr, session.input()))
+
+	io.Copy(io.MultiWriter(sconn, session.output()), cbr)
+}
+
+// HijackBuildWebsocket runs a process in the build's container and frames
+// its stdio as JSON messages over a websocket, so that it works through
+// proxies that do not pass raw upgraded connections.
+//
+// The client starts the session with a spec frame, then sends stdin and
+// close_stdin frames. Glider sends stdout frames followed by a final exit
+// frame once the output ends, or an error frame if the process could not be
+// started.
+//
+// Turbine's hijack protocol is a raw stream of the process's TTY, so there is
+// no way to resize it, to tell stderr from stdout, or to learn the exit
+// status; the frames only carry what turbine provides.
+func (handler *Handler) HijackBuildWebsocket(w http.ResponseWriter, r *http.Request) {
+	guid := r.FormValue(":guid")
+
+	build, found := handler.lookupBuild(r, guid)
+
+	if !found {
+		writeBuildNotFound(w, guid)
+		return
+	}
+
+	log := handler.logger.Session("hijack-websocket", lager.Data{
+		"build": build.Redacted(),
+	})
+
+	session, err := handler.reserveHijack(r, build)
+	if err != nil {
+		writeTooManyHijacks(w, handler.maxHijacksPerBuild)
+		return
+	}
+
+	defer handler.releaseHijack(session)
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Error("failed-to-upgrade", err)
+		return
+	}
+
+	defer conn.Close()
+
+	session.attach(conn)
+
+	var spec builds.HijackFrame
+	err = conn.ReadJSON(&spec)
+	if err != nil {
+		log.Error("failed-to-read-spec", err)
+		writeHijackError(conn, "malformed spec frame: "+err.Error())
+		return
+	}
+
+	if spec.Type != builds.HijackFrameSpec {
+		writeHijackError(conn, "expected a spec frame, got "+spec.Type)
+		return
+	}
+
+	log.Info("hijacking")
+
+	client, resp, err := handler.hijackTurbine(build, "POST", bytes.NewReader(spec.Spec))
 	if err != nil {
 		log.Error("failed-to-hijack", err)
-		w.WriteHeader(http.StatusInternalServerError)
+		writeHijackError(conn, "failed to hijack build: "+err.Error())
 		return
 	}
 
@@ -64,26 +164,150 @@ func (handler *Handler) HijackBuild(w http.ResponseWriter, r *http.Request) {
 			"status": resp.Status,
 		})
 
-		resp.Write(w)
+		body, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		client.Close()
+
+		writeHijackError(conn, "turbine responded with "+resp.Status+": "+string(body))
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
+	process, processOutput := client.Hijack()
+	defer process.Close()
 
-	sconn, sbr, err := w.(http.Hijacker).Hijack()
+	session.attach(process)
+
+	log.Info("hijacked")
+
+	metrics.HijackSessions.Inc()
+	defer metrics.HijackSessions.Dec()
+
+	handler.startHijack(log, session)
+	defer handler.endHijack(log, session)
+
+	stopTimeouts := handler.enforceTimeouts(log, session)
+	defer stopTimeouts()
+
+	go forwardHijackInput(log, conn, process, session)
+
+	err = forwardHijackOutput(conn, processOutput, session)
 	if err != nil {
-		log.Error("failed-to-hijack", err)
+		log.Error("failed-to-forward-output", err)
 		return
 	}
 
-	cconn, cbr := client.Hijack()
+	conn.WriteJSON(builds.HijackFrame{Type: builds.HijackFrameExit})
+}
 
-	defer cconn.Close()
-	defer sconn.Close()
+// hijackTurbine asks turbine to run a process in the build's container,
+// returning the connection to turbine along with its response.
+func (handler *Handler) hijackTurbine(build *builds.Build, method string, spec io.Reader) (*httputil.ClientConn, *http.Response, error) {
+	handler.buildsMutex.RLock()
+	hijackURL := build.HijackURL
+	handler.buildsMutex.RUnlock()
 
-	log.Info("hijacked")
+	parsedURL, err := url.Parse(hijackURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	startedAt := time.Now()
 
-	go io.Copy(cconn, sbr)
+	conn, err := net.Dial("tcp", parsedURL.Host)
+	if err != nil {
+		metrics.TurbineErrors.Inc("hijack")
+		return nil, nil, err
+	}
+
+	req, err := http.NewRequest(method, hijackURL, spec)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
 
-	io.Copy(sconn, cbr)
+	client := httputil.NewClientConn(conn, nil)
+
+	resp, err := client.Do(req)
+
+	metrics.TurbineRequestDuration.Observe(time.Since(startedAt).Seconds(), "hijack")
+
+	if err != nil {
+		metrics.TurbineErrors.Inc("hijack")
+		client.Close()
+		return nil, nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		metrics.TurbineErrors.Inc("hijack")
+	}
+
+	return client, resp, nil
+}
+
+// forwardHijackInput relays the client's frames to the process until the
+// websocket is closed, at which point the process's connection is closed too.
+func forwardHijackInput(log lager.Logger, conn *websocket.Conn, process net.Conn, session *hijackSession) {
+	defer process.Close()
+
+	for {
+		var frame builds.HijackFrame
+		err := conn.ReadJSON(&frame)
+		if err != nil {
+			return
+		}
+
+		switch frame.Type {
+		case builds.HijackFrameStdin:
+			_, err := io.MultiWriter(process, session.input()).Write(frame.Data)
+			if err != nil {
+				return
+			}
+
+		case builds.HijackFrameCloseStdin:
+			if closer, ok := process.(interface {
+				CloseWrite() error
+			}); ok {
+				closer.CloseWrite()
+			}
+
+		default:
+			log.Info("unknown-frame", lager.Data{
+				"type": frame.Type,
+			})
+		}
+	}
+}
+
+func forwardHijackOutput(conn *websocket.Conn, output *bufio.Reader, session *hijackSession) error {
+	buf := make([]byte, 32*1024)
+
+	for {
+		n, err := output.Read(buf)
+		if n > 0 {
+			session.output().Write(buf[:n])
+
+			writeErr := conn.WriteJSON(builds.HijackFrame{
+				Type: builds.HijackFrameStdout,
+				Data: buf[:n],
+			})
+			if writeErr != nil {
+				return writeErr
+			}
+		}
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func writeHijackError(conn *websocket.Conn, message string) {
+	conn.WriteJSON(builds.HijackFrame{
+		Type:    builds.HijackFrameError,
+		Message: message,
+	})
 }
@@ -0,0 +1,384 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/nu7hatch/gouuid"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/concourse/glider/api/builds"
+	"github.com/concourse/glider/asciicast"
+	"github.com/concourse/glider/auth"
+	"github.com/concourse/glider/store"
+)
+
+// terminal size assumed for recordings, as turbine's TTY cannot be resized
+const (
+	defaultTerminalWidth  = 80
+	defaultTerminalHeight = 24
+)
+
+type hijackSession struct {
+	record builds.HijackSession
+
+	// nil unless hijacks are being recorded
+	recorder *asciicast.Recorder
+
+	// connections to close in order to terminate the session
+	conns      []io.Closer
+	terminated bool
+
+	// reset by any input or output; nil if there is no idle timeout
+	idleTimer   *time.Timer
+	idleTimeout time.Duration
+
+	// guards record, conns, terminated and idleTimer
+	mutex *sync.Mutex
+}
+
+var errTooManyHijacks = errors.New("too many hijack sessions")
+
+func (handler *Handler) GetHijacks(w http.ResponseWriter, r *http.Request) {
+	guid := r.FormValue(":guid")
+
+	_, found := handler.lookupBuild(r, guid)
+
+	if !found {
+		writeBuildNotFound(w, guid)
+		return
+	}
+
+	sessions, err := handler.store.Hijacks(guid)
+	if err != nil {
+		handler.logger.Error("failed-to-get-hijacks", err)
+		writeInternalError(w, err)
+		return
+	}
+
+	handler.hijacksMutex.Lock()
+	for i, session := range sessions {
+		_, sessions[i].Active = handler.hijacks[guid][session.ID]
+	}
+	handler.hijacksMutex.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// GetActiveHijacks lists the hijack sessions in progress across all builds.
+func (handler *Handler) GetActiveHijacks(w http.ResponseWriter, r *http.Request) {
+	sessions := []builds.HijackSession{}
+
+	handler.hijacksMutex.Lock()
+	for _, buildSessions := range handler.hijacks {
+		for _, session := range buildSessions {
+			record := session.snapshot()
+
+			// sessions still connecting to turbine have not started yet
+			if !record.StartedAt.IsZero() {
+				record.Active = true
+				sessions = append(sessions, record)
+			}
+		}
+	}
+	handler.hijacksMutex.Unlock()
+
+	sort.Sort(builds.HijackSessionsByStartedAt(sessions))
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(sessions)
+}
+
+// TerminateHijack forcibly ends a hijack session.
+func (handler *Handler) TerminateHijack(w http.ResponseWriter, r *http.Request) {
+	guid := r.FormValue(":guid")
+	id := r.FormValue(":id")
+
+	handler.hijacksMutex.Lock()
+	session, found := handler.hijacks[guid][id]
+	handler.hijacksMutex.Unlock()
+
+	if !found {
+		writeError(w, http.StatusNotFound, builds.ErrorHijackNotFound, "no active hijack session '"+id+"'", nil)
+		return
+	}
+
+	handler.logger.Info("terminating-hijack", lager.Data{
+		"session": session.snapshot(),
+		"by":      auth.IdentityFrom(r).User,
+	})
+
+	session.terminate()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (handler *Handler) GetHijackRecording(w http.ResponseWriter, r *http.Request) {
+	guid := r.FormValue(":guid")
+	id := r.FormValue(":id")
+
+	_, found := handler.lookupBuild(r, guid)
+
+	if !found {
+		writeBuildNotFound(w, guid)
+		return
+	}
+
+	recording, err := handler.store.Recording(guid, id)
+	if err == store.ErrNotFound {
+		writeError(w, http.StatusNotFound, builds.ErrorRecordingNotFound, "no recording of hijack session '"+id+"'", nil)
+		return
+	}
+
+	if err != nil {
+		handler.logger.Error("failed-to-get-recording", err)
+		writeInternalError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", asciicast.ContentType)
+	w.WriteHeader(http.StatusOK)
+	w.Write(recording)
+}
+
+// reserveHijack registers a new hijack session by the requesting user,
+// provided the build has not reached its limit of concurrent sessions. The
+// session must be released once it is over.
+func (handler *Handler) reserveHijack(r *http.Request, build *builds.Build) (*hijackSession, error) {
+	id, err := uuid.NewV4()
+	if err != nil {
+		panic(err)
+	}
+
+	identity := auth.IdentityFrom(r)
+
+	session := &hijackSession{
+		record: builds.HijackSession{
+			ID:    id.String(),
+			Build: build.Guid,
+
+			User: identity.User,
+			Team: identity.Team,
+
+			Recorded: handler.recordHijacks,
+		},
+
+		mutex: new(sync.Mutex),
+	}
+
+	handler.hijacksMutex.Lock()
+	defer handler.hijacksMutex.Unlock()
+
+	sessions, found := handler.hijacks[build.Guid]
+	if !found {
+		sessions = make(map[string]*hijackSession)
+		handler.hijacks[build.Guid] = sessions
+	}
+
+	if handler.maxHijacksPerBuild > 0 && len(sessions) >= handler.maxHijacksPerBuild {
+		return nil, errTooManyHijacks
+	}
+
+	sessions[session.record.ID] = session
+
+	return session, nil
+}
+
+func (handler *Handler) releaseHijack(session *hijackSession) {
+	handler.hijacksMutex.Lock()
+	defer handler.hijacksMutex.Unlock()
+
+	sessions := handler.hijacks[session.record.Build]
+
+	delete(sessions, session.record.ID)
+
+	if len(sessions) == 0 {
+		delete(handler.hijacks, session.record.Build)
+	}
+}
+
+// terminateHijacks ends every hijack session of the build.
+func (handler *Handler) terminateHijacks(log lager.Logger, guid string) {
+	handler.hijacksMutex.Lock()
+	sessions := make([]*hijackSession, 0, len(handler.hijacks[guid]))
+	for _, session := range handler.hijacks[guid] {
+		sessions = append(sessions, session)
+	}
+	handler.hijacksMutex.Unlock()
+
+	for _, session := range sessions {
+		log.Info("terminating-hijack", lager.Data{
+			"session": session.snapshot(),
+		})
+
+		session.terminate()
+	}
+}
+
+// startHijack records the start of a hijack session.
+func (handler *Handler) startHijack(log lager.Logger, session *hijackSession) {
+	session.mutex.Lock()
+	session.record.StartedAt = time.Now()
+
+	if handler.recordHijacks {
+		session.recorder = asciicast.NewRecorder(
+			defaultTerminalWidth,
+			defaultTerminalHeight,
+			session.record.StartedAt,
+			handler.maxRecordingSize,
+		)
+	}
+	session.mutex.Unlock()
+
+	record := session.snapshot()
+
+	log.Info("session-started", lager.Data{
+		"session": record,
+	})
+
+	err := handler.store.SaveHijack(record)
+	if err != nil {
+		log.Error("failed-to-save-session", err)
+	}
+}
+
+// endHijack records the end of a hijack session, along with its transcript.
+func (handler *Handler) endHijack(log lager.Logger, session *hijackSession) {
+	session.mutex.Lock()
+	session.record.EndedAt = time.Now()
+	session.record.Duration = session.record.EndedAt.Sub(session.record.StartedAt).Seconds()
+
+	if session.recorder != nil {
+		session.record.Truncated = session.recorder.Truncated()
+	}
+	session.mutex.Unlock()
+
+	record := session.snapshot()
+
+	log.Info("session-ended", lager.Data{
+		"session": record,
+	})
+
+	if session.recorder != nil {
+		err := handler.store.SaveRecording(record.Build, record.ID, session.recorder.Bytes())
+		if err != nil {
+			log.Error("failed-to-save-recording", err)
+		}
+	}
+
+	err := handler.store.SaveHijack(record)
+	if err != nil {
+		log.Error("failed-to-save-session", err)
+	}
+}
+
+func (session *hijackSession) snapshot() builds.HijackSession {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	return session.record
+}
+
+// attach ties the connection's lifetime to the session's. If the session has
+// already been terminated, the connection is closed immediately.
+func (session *hijackSession) attach(conn io.Closer) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if session.terminated {
+		conn.Close()
+		return
+	}
+
+	session.conns = append(session.conns, conn)
+}
+
+func (session *hijackSession) terminate() {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	session.terminated = true
+
+	for _, conn := range session.conns {
+		conn.Close()
+	}
+}
+
+// enforceTimeouts terminates the session once it has gone without input or
+// output for the handler's idle timeout, or has lasted for its absolute
+// timeout. The returned function stops enforcing them.
+func (handler *Handler) enforceTimeouts(log lager.Logger, session *hijackSession) func() {
+	expire := func(reason string) func() {
+		return func() {
+			handler.connectionClosed(log, "hijack", reason)
+			session.terminate()
+		}
+	}
+
+	timers := []*time.Timer{}
+
+	if handler.hijackIdleTimeout != 0 {
+		session.mutex.Lock()
+		session.idleTimeout = handler.hijackIdleTimeout
+		session.idleTimer = time.AfterFunc(handler.hijackIdleTimeout, expire("idle"))
+		timers = append(timers, session.idleTimer)
+		session.mutex.Unlock()
+	}
+
+	if handler.hijackTimeout != 0 {
+		timers = append(timers, time.AfterFunc(handler.hijackTimeout, expire("timeout")))
+	}
+
+	return func() {
+		for _, timer := range timers {
+			timer.Stop()
+		}
+	}
+}
+
+// touch notes activity on the session, postponing its idle timeout.
+func (session *hijackSession) touch() {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if session.idleTimer != nil {
+		session.idleTimer.Reset(session.idleTimeout)
+	}
+}
+
+// input returns a writer to which the session's input should be copied, so
+// that it is recorded and counts as activity.
+func (session *hijackSession) input() io.Writer {
+	if session.recorder == nil {
+		return activityWriter{session, ioutil.Discard}
+	}
+
+	return activityWriter{session, session.recorder.Input()}
+}
+
+// output returns a writer to which the session's output should be copied, so
+// that it is recorded and counts as activity.
+func (session *hijackSession) output() io.Writer {
+	if session.recorder == nil {
+		return activityWriter{session, ioutil.Discard}
+	}
+
+	return activityWriter{session, session.recorder.Output()}
+}
+
+type activityWriter struct {
+	session *hijackSession
+	writer  io.Writer
+}
+
+func (writer activityWriter) Write(data []byte) (int, error) {
+	writer.session.touch()
+	return writer.writer.Write(data)
+}
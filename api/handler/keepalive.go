@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// keepAlive pings a websocket's peer and sets a read deadline of twice the
+// ping interval, extended whenever a pong arrives or alive is called, so
+// that reads from a dead peer fail. Pongs are only processed while reading,
+// and alive should be called after each message read.
+type keepAlive struct {
+	conn     *websocket.Conn
+	interval time.Duration
+
+	// whether the read deadline is set at all; peers that never read never
+	// answer pings, so can only be pinged
+	enforced bool
+
+	deadline time.Time
+
+	stopping chan struct{}
+}
+
+// startKeepAlive starts pinging the peer every interval, unless interval is
+// 0. The keepalive must be stopped once the connection is done with.
+func startKeepAlive(conn *websocket.Conn, interval time.Duration) *keepAlive {
+	keepAlive := startPinging(conn, interval)
+
+	if interval == 0 {
+		return keepAlive
+	}
+
+	keepAlive.enforced = true
+	keepAlive.alive()
+
+	conn.SetPongHandler(func(string) error {
+		keepAlive.alive()
+		return nil
+	})
+
+	return keepAlive
+}
+
+// startPinging is startKeepAlive without the read deadline, for peers that
+// never read, and so never answer pings, but whose connections should still
+// see traffic. Reads never fail for want of a pong.
+func startPinging(conn *websocket.Conn, interval time.Duration) *keepAlive {
+	keepAlive := &keepAlive{
+		conn:     conn,
+		interval: interval,
+
+		stopping: make(chan struct{}),
+	}
+
+	if interval != 0 {
+		go keepAlive.ping()
+	}
+
+	return keepAlive
+}
+
+func (keepAlive *keepAlive) alive() {
+	if !keepAlive.enforced {
+		return
+	}
+
+	keepAlive.deadline = time.Now().Add(2 * keepAlive.interval)
+	keepAlive.conn.SetReadDeadline(keepAlive.deadline)
+}
+
+// expired returns true if a read failed because the peer stopped responding.
+func (keepAlive *keepAlive) expired() bool {
+	return keepAlive.enforced && time.Now().After(keepAlive.deadline)
+}
+
+func (keepAlive *keepAlive) stop() {
+	close(keepAlive.stopping)
+}
+
+func (keepAlive *keepAlive) ping() {
+	ticker := time.NewTicker(keepAlive.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			err := keepAlive.conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(keepAlive.interval))
+			if err != nil {
+				return
+			}
+
+		case <-keepAlive.stopping:
+			return
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package handler
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/concourse/glider/api/builds"
+	"github.com/concourse/glider/metrics"
+	"github.com/concourse/glider/policy"
+)
+
+// rule reported for labels that are malformed
+const ruleLabels = "labels"
+
+var labelKeyPattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_./-]*$`)
+
+// validateLabels checks that every label can be selected by, i.e. that
+// neither its key nor its value would be mistaken for part of a selector.
+func validateLabels(labels map[string]string) []policy.Violation {
+	keys := make([]string, 0, len(labels))
+	for key := range labels {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	violations := []policy.Violation{}
+
+	for _, key := range keys {
+		if !labelKeyPattern.MatchString(key) {
+			violations = append(violations, policy.Violation{
+				Rule:    ruleLabels,
+				Message: "invalid label key: " + key,
+			})
+		}
+
+		if strings.ContainsAny(labels[key], ",=") {
+			violations = append(violations, policy.Violation{
+				Rule:    ruleLabels,
+				Message: fmt.Sprintf("value of label %s may not contain ',' or '='", key),
+			})
+		}
+	}
+
+	return violations
+}
+
+// parseLabelSelector parses a comma-separated list of key=value pairs, all
+// of which a build's labels must have to match.
+func parseLabelSelector(selector string) (map[string]string, error) {
+	labels := make(map[string]string)
+
+	for _, requirement := range strings.Split(selector, ",") {
+		pair := strings.SplitN(requirement, "=", 2)
+		if len(pair) != 2 || pair[0] == "" {
+			return nil, fmt.Errorf("malformed label selector: %s", requirement)
+		}
+
+		labels[pair[0]] = pair[1]
+	}
+
+	return labels, nil
+}
+
+// countCreated counts the build's creation by each of its labels configured
+// for metrics.
+func (handler *Handler) countCreated(build *builds.Build) {
+	metrics.BuildsCreated.Inc()
+
+	for key := range handler.metricLabels {
+		if value, found := build.Labels[key]; found {
+			metrics.LabelledBuildsCreated.Inc(key, handler.metricLabels.Value(key, value))
+		}
+	}
+}
+
+// countStatus counts the build reaching the status, in total and by each of
+// its labels configured for metrics. A build's labels never change, so they
+// can be read without the builds mutex.
+func (handler *Handler) countStatus(build *builds.Build, status string) {
+	metrics.BuildStatuses.Inc(status)
+
+	for key := range handler.metricLabels {
+		if value, found := build.Labels[key]; found {
+			metrics.LabelledBuildStatuses.Inc(key, handler.metricLabels.Value(key, value), status)
+		}
+	}
+}
@@ -3,15 +3,21 @@ package handler
 import (
 	"encoding/json"
 	"net/http"
+	"sync/atomic"
 
 	"github.com/gorilla/websocket"
 	"github.com/pivotal-golang/lager"
+
+	"github.com/concourse/glider/api/builds"
+	"github.com/concourse/glider/metrics"
 )
 
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(*http.Request) bool {
 		return true
 	},
+
+	Error: writeHandshakeError,
 }
 
 func (handler *Handler) LogInput(w http.ResponseWriter, r *http.Request) {
@@ -21,22 +27,52 @@ func (handler *Handler) LogInput(w http.ResponseWriter, r *http.Request) {
 		"guid": guid,
 	})
 
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Error("failed-to-upgrade", err)
+	handler.buildsMutex.RLock()
+	build, found := handler.builds[guid]
+	var snapshot builds.Build
+	if found {
+		snapshot = *build
+	}
+	handler.buildsMutex.RUnlock()
+
+	if !found {
+		writeBuildNotFound(w, guid)
 		return
 	}
 
+	// the log can only contain secrets that were given to turbine, which
+	// can only happen if they could be decrypted
+	unsealed, err := handler.unsealSecrets(snapshot)
+	if err != nil {
+		log.Error("failed-to-decrypt-secrets", err)
+	}
+
+	redactor := newLogRedactor(unsealed)
+
 	handler.logsMutex.RLock()
 	logBuffer, found := handler.logs[guid]
+	logBytes := handler.logBytes[guid]
 	handler.logsMutex.RUnlock()
 
 	if !found {
+		writeBuildNotFound(w, guid)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Error("failed-to-upgrade", err)
 		return
 	}
 
+	defer conn.Close()
 	defer logBuffer.Close()
 
+	// turbine never reads from the log, so never answers pings; expiring
+	// the connection would end the log for every viewer
+	pinging := startPinging(conn, handler.keepaliveInterval)
+	defer pinging.stop()
+
 	for {
 		var msg *json.RawMessage
 		err := conn.ReadJSON(&msg)
@@ -44,7 +80,13 @@ func (handler *Handler) LogInput(w http.ResponseWriter, r *http.Request) {
 			break
 		}
 
+		msg = redactor.redact(msg)
+
 		logBuffer.WriteMessage(msg)
+
+		if msg != nil {
+			atomic.AddInt64(logBytes, int64(len(*msg)))
+		}
 	}
 }
 
@@ -55,9 +97,9 @@ func (handler *Handler) LogOutput(w http.ResponseWriter, r *http.Request) {
 		"guid": guid,
 	})
 
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Error("failed-to-upgrade", err)
+	_, found := handler.lookupBuild(r, guid)
+	if !found {
+		writeBuildNotFound(w, guid)
 		return
 	}
 
@@ -66,8 +108,72 @@ func (handler *Handler) LogOutput(w http.ResponseWriter, r *http.Request) {
 	handler.logsMutex.RUnlock()
 
 	if !found {
+		writeBuildNotFound(w, guid)
+		return
+	}
+
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Error("failed-to-upgrade", err)
 		return
 	}
 
-	logBuffer.Attach(conn)
+	metrics.LogSinks.Inc()
+	defer metrics.LogSinks.Dec()
+
+	// the replay can be long, so runs alongside the reads that notice the
+	// client going away
+	attached := make(chan error, 1)
+	go func() {
+		attached <- logBuffer.Attach(conn)
+	}()
+
+	keepAlive := startKeepAlive(conn, handler.keepaliveInterval)
+	defer keepAlive.stop()
+
+	// the client never sends anything, but reading processes pongs and
+	// notices disconnects
+	disconnected := make(chan struct{})
+	go func() {
+		defer close(disconnected)
+
+		for {
+			_, _, err := conn.NextReader()
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	select {
+	case err := <-attached:
+		if err == nil {
+			select {
+			case <-logBuffer.Closed():
+				return
+			case <-disconnected:
+			}
+		}
+	case <-disconnected:
+		// closing the connection fails any replay still writing to it
+		conn.Close()
+		<-attached
+	}
+
+	if keepAlive.expired() {
+		handler.connectionClosed(log, "log_output", "keepalive")
+	}
+
+	conn.Close()
+	logBuffer.Detach(conn)
+}
+
+// connectionClosed records that glider gave up on a connection.
+func (handler *Handler) connectionClosed(log lager.Logger, connection string, reason string) {
+	log.Info("closing-dead-connection", lager.Data{
+		"connection": connection,
+		"reason":     reason,
+	})
+
+	metrics.ClosedConnections.Inc(connection, reason)
 }
@@ -0,0 +1,260 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/concourse/glider/api/builds"
+	"github.com/concourse/glider/auth"
+	"github.com/concourse/glider/metrics"
+)
+
+// suggested wait for quotas that are only freed up by builds finishing or
+// being deleted, which can't be predicted
+const quotaRetryAfter = time.Minute
+
+const (
+	quotaScopeUser = "user"
+	quotaScopeTeam = "team"
+)
+
+// quotaUsage is a team's or user's usage, along with what is needed to work
+// out when it will next fall.
+type quotaUsage struct {
+	builds.QuotaUsage
+
+	// when the earliest build created within the past hour was created
+	oldestThisHour time.Time
+}
+
+func (usage *quotaUsage) countCreations(recent []time.Time) {
+	usage.BuildsLastHour = len(recent)
+
+	if len(recent) > 0 {
+		usage.oldestThisHour = recent[0]
+	}
+}
+
+// quotaExceeded is a quota that a request would exceed.
+type quotaExceeded struct {
+	builds.QuotaDetails
+
+	// zero if waiting will not help
+	retryAfter time.Duration
+}
+
+func (exceeded *quotaExceeded) Error() string {
+	return fmt.Sprintf("%s '%s' has reached its %s quota of %d", exceeded.Scope, exceeded.Name, exceeded.Quota, exceeded.Limit)
+}
+
+// GetQuotas shows the limits and usage of the caller and their team.
+func (handler *Handler) GetQuotas(w http.ResponseWriter, r *http.Request) {
+	identity := auth.IdentityFrom(r)
+
+	handler.quotasMutex.Lock()
+	userUsage, teamUsage := handler.usage(identity.User, identity.Team, time.Now())
+	handler.quotasMutex.Unlock()
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(builds.Quotas{
+		User: builds.Quota{
+			Name:   identity.User,
+			Limits: handler.quotas.User(identity.User),
+			Usage:  userUsage.QuotaUsage,
+		},
+		Team: builds.Quota{
+			Name:   identity.Team,
+			Limits: handler.quotas.Team(identity.Team),
+			Usage:  teamUsage.QuotaUsage,
+		},
+	})
+}
+
+// checkBuildQuotas returns the first quota that creating another build would
+// exceed for the user or their team, if any. It must be called with the
+// quotas mutex held, through to registering the build.
+func (handler *Handler) checkBuildQuotas(user string, team string) *quotaExceeded {
+	now := time.Now()
+
+	userUsage, teamUsage := handler.usage(user, team, now)
+
+	exceeded := checkBuildQuota(quotaScopeUser, user, handler.quotas.User(user), userUsage, now)
+	if exceeded == nil {
+		exceeded = checkBuildQuota(quotaScopeTeam, team, handler.quotas.Team(team), teamUsage, now)
+	}
+
+	return exceeded
+}
+
+func checkBuildQuota(scope string, name string, limits builds.QuotaLimits, usage quotaUsage, now time.Time) *quotaExceeded {
+	exceeded := func(quota string, limit int64, retryAfter time.Duration) *quotaExceeded {
+		return &quotaExceeded{
+			QuotaDetails: builds.QuotaDetails{
+				Scope: scope,
+				Name:  name,
+				Quota: quota,
+				Limit: limit,
+			},
+			retryAfter: retryAfter,
+		}
+	}
+
+	if limits.ConcurrentBuilds > 0 && usage.ConcurrentBuilds >= limits.ConcurrentBuilds {
+		return exceeded("concurrent_builds", int64(limits.ConcurrentBuilds), quotaRetryAfter)
+	}
+
+	if limits.BuildsPerHour > 0 && usage.BuildsLastHour >= limits.BuildsPerHour {
+		wait := usage.oldestThisHour.Add(time.Hour).Sub(now)
+		if wait < time.Second {
+			wait = time.Second
+		}
+
+		return exceeded("builds_per_hour", int64(limits.BuildsPerHour), wait)
+	}
+
+	if limits.LogBytes > 0 && usage.LogBytes >= limits.LogBytes {
+		return exceeded("log_bytes", limits.LogBytes, quotaRetryAfter)
+	}
+
+	return nil
+}
+
+// maxBitsSize returns the largest bits the build's owners may upload, and
+// the quota that imposes it, or 0 if there is no limit.
+func (handler *Handler) maxBitsSize(build *builds.Build) (int64, *quotaExceeded) {
+	var max int64
+	var limiting *quotaExceeded
+
+	consider := func(scope string, name string, limits builds.QuotaLimits) {
+		if limits.MaxBitsSize > 0 && (max == 0 || limits.MaxBitsSize < max) {
+			max = limits.MaxBitsSize
+			limiting = &quotaExceeded{
+				QuotaDetails: builds.QuotaDetails{
+					Scope: scope,
+					Name:  name,
+					Quota: "max_bits_size",
+					Limit: max,
+				},
+			}
+		}
+	}
+
+	consider(quotaScopeUser, build.CreatedBy, handler.quotas.User(build.CreatedBy))
+	consider(quotaScopeTeam, build.Team, handler.quotas.Team(build.Team))
+
+	return max, limiting
+}
+
+// recordCreation counts the build's creation towards its creator's and
+// team's builds_per_hour. It must be called with the quotas mutex held.
+func (handler *Handler) recordCreation(build *builds.Build) {
+	if time.Since(build.CreatedAt) >= time.Hour {
+		return
+	}
+
+	if build.CreatedBy != "" {
+		handler.userCreations[build.CreatedBy] = insertCreation(handler.userCreations[build.CreatedBy], build.CreatedAt)
+	}
+
+	if build.Team != "" {
+		handler.teamCreations[build.Team] = insertCreation(handler.teamCreations[build.Team], build.CreatedAt)
+	}
+}
+
+// insertCreation adds the creation time, keeping the times oldest first.
+// Builds are mostly created in order, but are restored in any.
+func insertCreation(creations []time.Time, createdAt time.Time) []time.Time {
+	i := sort.Search(len(creations), func(i int) bool {
+		return creations[i].After(createdAt)
+	})
+
+	creations = append(creations, time.Time{})
+	copy(creations[i+1:], creations[i:])
+	creations[i] = createdAt
+
+	return creations
+}
+
+// creationsLastHour drops the creations of the user or team that are more
+// than an hour old, returning those that are left.
+func creationsLastHour(creations map[string][]time.Time, name string, now time.Time) []time.Time {
+	recent := creations[name]
+
+	for len(recent) > 0 && now.Sub(recent[0]) >= time.Hour {
+		recent = recent[1:]
+	}
+
+	if len(recent) == 0 {
+		delete(creations, name)
+		return nil
+	}
+
+	creations[name] = recent
+
+	return recent
+}
+
+// usage tallies the builds and logs of the user and of the team. It must be
+// called with the quotas mutex held.
+func (handler *Handler) usage(user string, team string, now time.Time) (quotaUsage, quotaUsage) {
+	var userUsage, teamUsage quotaUsage
+
+	userBuilds := []string{}
+	teamBuilds := []string{}
+
+	userUsage.countCreations(creationsLastHour(handler.userCreations, user, now))
+	teamUsage.countCreations(creationsLastHour(handler.teamCreations, team, now))
+
+	tally := func(usage *quotaUsage, build *builds.Build) {
+		if !build.Finished() {
+			usage.ConcurrentBuilds++
+		}
+	}
+
+	handler.buildsMutex.RLock()
+	for guid, build := range handler.builds {
+		if user != "" && build.CreatedBy == user {
+			tally(&userUsage, build)
+			userBuilds = append(userBuilds, guid)
+		}
+
+		if team != "" && build.Team == team {
+			tally(&teamUsage, build)
+			teamBuilds = append(teamBuilds, guid)
+		}
+	}
+	handler.buildsMutex.RUnlock()
+
+	handler.logsMutex.RLock()
+	for _, guid := range userBuilds {
+		if bytes, found := handler.logBytes[guid]; found {
+			userUsage.LogBytes += atomic.LoadInt64(bytes)
+		}
+	}
+
+	for _, guid := range teamBuilds {
+		if bytes, found := handler.logBytes[guid]; found {
+			teamUsage.LogBytes += atomic.LoadInt64(bytes)
+		}
+	}
+	handler.logsMutex.RUnlock()
+
+	return userUsage, teamUsage
+}
+
+func writeQuotaExceeded(w http.ResponseWriter, status int, message string, exceeded *quotaExceeded) {
+	metrics.QuotaRejections.Inc(exceeded.Quota)
+
+	if exceeded.retryAfter > 0 {
+		// round up, so that retrying on time succeeds
+		seconds := int((exceeded.retryAfter + time.Second - 1) / time.Second)
+		w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	}
+
+	writeError(w, status, builds.ErrorQuotaExceeded, message, exceeded.QuotaDetails)
+}
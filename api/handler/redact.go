@@ -0,0 +1,121 @@
+package handler
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+
+	"github.com/concourse/glider/api/builds"
+)
+
+// secrets shorter than this are left in logs, as redacting them would mangle
+// unrelated output
+const minRedactedSecretLength = 4
+
+// logRedactor scrubs the values of a build's secret params from the strings
+// in its log events.
+type logRedactor struct {
+	secrets []string
+
+	// the secrets as they appear within JSON strings, both with and without
+	// '<', '>' and '&' escaped, to cheaply skip events that don't contain any
+	encoded [][]byte
+}
+
+func newLogRedactor(build builds.Build) logRedactor {
+	redactor := logRedactor{}
+
+	for _, secret := range build.SecretValues() {
+		if len(secret) < minRedactedSecretLength {
+			continue
+		}
+
+		escaped, err := json.Marshal(secret)
+		if err != nil {
+			continue
+		}
+
+		buffer := new(bytes.Buffer)
+
+		encoder := json.NewEncoder(buffer)
+		encoder.SetEscapeHTML(false)
+
+		err = encoder.Encode(secret)
+		if err != nil {
+			continue
+		}
+
+		unescaped := bytes.TrimSpace(buffer.Bytes())
+
+		redactor.secrets = append(redactor.secrets, secret)
+		redactor.encoded = append(
+			redactor.encoded,
+			escaped[1:len(escaped)-1],
+			unescaped[1:len(unescaped)-1],
+		)
+	}
+
+	return redactor
+}
+
+func (redactor logRedactor) redact(msg *json.RawMessage) *json.RawMessage {
+	if msg == nil || !redactor.matches(*msg) {
+		return msg
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(*msg))
+	decoder.UseNumber()
+
+	var event interface{}
+	err := decoder.Decode(&event)
+	if err != nil {
+		return msg
+	}
+
+	redacted, err := json.Marshal(redactor.redactValue(event))
+	if err != nil {
+		return msg
+	}
+
+	raw := json.RawMessage(redacted)
+
+	return &raw
+}
+
+func (redactor logRedactor) matches(msg []byte) bool {
+	for _, encoded := range redactor.encoded {
+		if bytes.Contains(msg, encoded) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (redactor logRedactor) redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case string:
+		for _, secret := range redactor.secrets {
+			v = strings.Replace(v, secret, builds.RedactedValue, -1)
+		}
+
+		return v
+
+	case map[string]interface{}:
+		for key, nested := range v {
+			v[key] = redactor.redactValue(nested)
+		}
+
+		return v
+
+	case []interface{}:
+		for i, nested := range v {
+			v[i] = redactor.redactValue(nested)
+		}
+
+		return v
+
+	default:
+		return v
+	}
+}
@@ -2,12 +2,30 @@ package handler
 
 import (
 	"encoding/json"
+	"fmt"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/concourse/glider/api/builds"
+	"github.com/concourse/glider/events"
+	"github.com/concourse/glider/webhooks"
 	"github.com/pivotal-golang/lager"
 )
 
+// how long GET /builds/:guid/result?wait=true blocks when no timeout is given
+const defaultResultTimeout = time.Minute
+
+// the statuses turbine reports; anything else is refused, as statuses are
+// counted in the metrics
+var resultStatuses = map[string]bool{
+	builds.StatusStarted:   true,
+	builds.StatusSucceeded: true,
+	builds.StatusFailed:    true,
+	builds.StatusErrored:   true,
+	builds.StatusAborted:   true,
+}
+
 func (handler *Handler) SetResult(w http.ResponseWriter, r *http.Request) {
 	guid := r.FormValue(":guid")
 
@@ -16,18 +34,23 @@ func (handler *Handler) SetResult(w http.ResponseWriter, r *http.Request) {
 	handler.buildsMutex.RUnlock()
 
 	if !found {
-		w.WriteHeader(http.StatusNotFound)
+		writeBuildNotFound(w, guid)
 		return
 	}
 
 	log := handler.logger.Session("set-result", lager.Data{
-		"build": build,
+		"build": build.Redacted(),
 	})
 
 	var result builds.BuildResult
 	err := json.NewDecoder(r.Body).Decode(&result)
 	if err != nil {
-		w.WriteHeader(http.StatusBadRequest)
+		writeError(w, http.StatusBadRequest, builds.ErrorMalformedRequest, "malformed result: "+err.Error(), nil)
+		return
+	}
+
+	if !resultStatuses[result.Status] {
+		writeError(w, http.StatusBadRequest, builds.ErrorMalformedRequest, "unknown status: "+result.Status, nil)
 		return
 	}
 
@@ -36,9 +59,43 @@ func (handler *Handler) SetResult(w http.ResponseWriter, r *http.Request) {
 	})
 
 	handler.buildsMutex.Lock()
+
+	// the build has already been finished off by glider
+	if build.Status == builds.StatusAborted {
+		handler.buildsMutex.Unlock()
+
+		log.Info("ignoring-result-of-aborted-build")
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+
 	build.Status = result.Status
+	build.ExitStatus = result.ExitStatus
+	build.Error = result.Error
+	finished := build.Finished()
+	if finished && build.FinishedAt.IsZero() {
+		build.FinishedAt = time.Now()
+	}
 	handler.buildsMutex.Unlock()
 
+	if finished {
+		handler.finish(guid)
+		handler.terminateHijacks(log, guid)
+	}
+
+	handler.saveBuild(log, build)
+	handler.publish(events.StatusChanged, build)
+
+	if result.Status == builds.StatusStarted {
+		handler.notify(webhooks.EventStarted, build)
+	} else if finished {
+		handler.notify(webhooks.EventFinished, build)
+	}
+
+	handler.countStatus(build, result.Status)
+
 	w.WriteHeader(http.StatusOK)
 	json.NewEncoder(w).Encode(result)
 }
@@ -46,15 +103,116 @@ func (handler *Handler) SetResult(w http.ResponseWriter, r *http.Request) {
 func (handler *Handler) GetResult(w http.ResponseWriter, r *http.Request) {
 	guid := r.FormValue(":guid")
 
+	build, found := handler.lookupBuild(r, guid)
+
+	if !found {
+		writeBuildNotFound(w, guid)
+		return
+	}
+
+	status := http.StatusOK
+
+	if r.URL.Query().Get("wait") == "true" {
+		timeout := defaultResultTimeout
+
+		if param := r.URL.Query().Get("timeout"); param != "" {
+			var err error
+
+			timeout, err = parseDuration(param)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, builds.ErrorMalformedRequest, "malformed timeout: "+err.Error(), nil)
+				return
+			}
+		}
+
+		if !handler.waitForFinish(r, guid, timeout) {
+			status = http.StatusAccepted
+		}
+	}
+
 	handler.buildsMutex.RLock()
-	build, found := handler.builds[guid]
+	result := builds.BuildResult{
+		Status:     build.Status,
+		FinishedAt: build.FinishedAt,
+		ExitStatus: build.ExitStatus,
+		Error:      build.Error,
+	}
 	handler.buildsMutex.RUnlock()
 
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+// finish wakes anyone waiting on the build's result. It is safe to call more
+// than once.
+func (handler *Handler) finish(guid string) {
+	handler.buildsMutex.Lock()
+	defer handler.buildsMutex.Unlock()
+
+	finished, found := handler.finished[guid]
 	if !found {
-		w.WriteHeader(http.StatusNotFound)
 		return
 	}
 
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(builds.BuildResult{build.Status})
+	select {
+	case <-finished:
+	default:
+		close(finished)
+	}
+}
+
+// waitForFinish blocks until the build reaches a terminal status, the
+// timeout elapses, or the client goes away. It returns true if the build
+// finished.
+func (handler *Handler) waitForFinish(r *http.Request, guid string, timeout time.Duration) bool {
+	handler.buildsMutex.RLock()
+	build, found := handler.builds[guid]
+	done := found && build.Finished()
+	finished, waitable := handler.finished[guid]
+	handler.buildsMutex.RUnlock()
+
+	if done {
+		return true
+	}
+
+	// the build has been deleted, so will never finish
+	if !waitable {
+		return false
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-finished:
+		return true
+	case <-timer.C:
+		return false
+	case <-r.Context().Done():
+		return false
+	}
+}
+
+// parseDuration accepts either a duration ("90s", "5m") or a number of
+// seconds.
+func parseDuration(param string) (time.Duration, error) {
+	seconds, err := strconv.Atoi(param)
+	if err == nil {
+		if seconds < 0 {
+			return 0, fmt.Errorf("negative duration: %d", seconds)
+		}
+
+		return time.Duration(seconds) * time.Second, nil
+	}
+
+	timeout, err := time.ParseDuration(param)
+	if err != nil {
+		return 0, err
+	}
+
+	if timeout < 0 {
+		return 0, fmt.Errorf("negative duration: %s", param)
+	}
+
+	return timeout, nil
 }
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/concourse/glider/api/builds"
+	"github.com/concourse/glider/policy"
+	"github.com/concourse/glider/secrets"
+)
+
+// rule reported for secret params that cannot be sealed
+const ruleSecretParams = "secret_params"
+
+// validateSecretParams refuses secret params whose values look encrypted, as
+// they would be taken for ones sealed by a keyring, and fail to decrypt when
+// the build is triggered.
+func validateSecretParams(build builds.Build) []policy.Violation {
+	names := make([]string, 0, len(build.Config.Params))
+	for name := range build.Config.Params {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	violations := []policy.Violation{}
+
+	for _, name := range names {
+		if build.IsSecretParam(name) && secrets.IsEncrypted(build.Config.Params[name]) {
+			violations = append(violations, policy.Violation{
+				Rule:    ruleSecretParams,
+				Message: "value of secret param " + name + " may not look encrypted",
+			})
+		}
+	}
+
+	return violations
+}
+
+// templateSecrets views the template as a build, so that its secret params
+// are sealed and unsealed just as a build's are.
+func templateSecrets(template builds.Template) builds.Build {
+	return builds.Build{
+		Config:       template.Config,
+		SecretParams: template.SecretParams,
+	}
+}
+
+// sealSecrets encrypts the values of the build's secret params, so that they
+// are only ever held encrypted, in memory and in the store. Without a keyring
+// they are left as they are.
+func (handler *Handler) sealSecrets(build *builds.Build) error {
+	if handler.keyring == nil || len(build.Config.Params) == 0 {
+		return nil
+	}
+
+	params := make(map[string]string, len(build.Config.Params))
+
+	for name, value := range build.Config.Params {
+		if value != "" && build.IsSecretParam(name) {
+			encrypted, err := handler.keyring.Encrypt(value)
+			if err != nil {
+				return err
+			}
+
+			value = encrypted
+		}
+
+		params[name] = value
+	}
+
+	build.Config.Params = params
+
+	return nil
+}
+
+// unsealSecrets returns a copy of the build with the values of its secret
+// params decrypted, for handing to turbine.
+func (handler *Handler) unsealSecrets(build builds.Build) (builds.Build, error) {
+	params := make(map[string]string, len(build.Config.Params))
+
+	for name, value := range build.Config.Params {
+		if secrets.IsEncrypted(value) && build.IsSecretParam(name) {
+			if handler.keyring == nil {
+				return builds.Build{}, fmt.Errorf("param %s is encrypted, but no key was given", name)
+			}
+
+			decrypted, err := handler.keyring.Decrypt(value)
+			if err != nil {
+				return builds.Build{}, fmt.Errorf("failed to decrypt param %s: %s", name, err)
+			}
+
+			value = decrypted
+		}
+
+		params[name] = value
+	}
+
+	build.Config.Params = params
+
+	return build, nil
+}
+
+// resealSecrets brings the encryption of a stored build's secret params up
+// to date with the keyring, encrypting any that were stored in plaintext and
+// re-encrypting any sealed with an older key. It returns true if anything
+// changed.
+func (handler *Handler) resealSecrets(build *builds.Build) (bool, error) {
+	if handler.keyring == nil {
+		// fail now rather than when the build is triggered
+		_, err := handler.unsealSecrets(*build)
+		return false, err
+	}
+
+	stale := false
+
+	for name, value := range build.Config.Params {
+		if value != "" && build.IsSecretParam(name) && !handler.keyring.IsCurrent(value) {
+			stale = true
+		}
+	}
+
+	if !stale {
+		return false, nil
+	}
+
+	unsealed, err := handler.unsealSecrets(*build)
+	if err != nil {
+		return false, err
+	}
+
+	err = handler.sealSecrets(&unsealed)
+	if err != nil {
+		return false, err
+	}
+
+	build.Config.Params = unsealed.Config.Params
+
+	return true, nil
+}
@@ -15,3 +15,17 @@ func (builds ByCreatedAt) Less(i, j int) bool {
 func (builds ByCreatedAt) Swap(i, j int) {
 	builds[i], builds[j] = builds[j], builds[i]
 }
+
+type templatesByName []builds.Template
+
+func (templates templatesByName) Len() int {
+	return len(templates)
+}
+
+func (templates templatesByName) Less(i, j int) bool {
+	return templates[i].Name < templates[j].Name
+}
+
+func (templates templatesByName) Swap(i, j int) {
+	templates[i], templates[j] = templates[j], templates[i]
+}
@@ -0,0 +1,104 @@
+package handler
+
+import (
+	"fmt"
+
+	"github.com/pivotal-golang/lager"
+
+	"github.com/concourse/glider/api/builds"
+	"github.com/concourse/glider/store"
+)
+
+// Restore registers every build and template found in the store. Logs are
+// not persisted, so finished builds come back with an empty, closed log.
+//
+// Secret params, of builds and templates alike, are re-encrypted with the
+// current key if they were encrypted with an older one, or stored before a
+// key was given.
+func (handler *Handler) Restore() error {
+	saved, err := handler.store.Builds()
+	if err != nil {
+		return err
+	}
+
+	resealed := 0
+
+	for _, savedBuild := range saved {
+		build := savedBuild.Restore()
+
+		changed, err := handler.resealSecrets(&build)
+		if err != nil {
+			return fmt.Errorf("build %s: %s", build.Guid, err)
+		}
+
+		logBuffer := handler.register(&build)
+
+		handler.quotasMutex.Lock()
+		handler.recordCreation(&build)
+		handler.quotasMutex.Unlock()
+
+		if build.Finished() {
+			logBuffer.Close()
+			handler.finish(build.Guid)
+		}
+
+		if changed {
+			handler.saveBuild(handler.logger, &build)
+			resealed++
+		}
+	}
+
+	templates, err := handler.store.Templates()
+	if err != nil {
+		return err
+	}
+
+	for i, template := range templates {
+		secretParams := templateSecrets(template)
+
+		changed, err := handler.resealSecrets(&secretParams)
+		if err != nil {
+			return fmt.Errorf("template %s/%s: %s", template.Team, template.Name, err)
+		}
+
+		if changed {
+			templates[i].Config = secretParams.Config
+
+			err = handler.store.SaveTemplate(templates[i])
+			if err != nil {
+				handler.logger.Error("failed-to-save-template", err)
+			}
+
+			resealed++
+		}
+	}
+
+	handler.templatesMutex.Lock()
+	for _, template := range templates {
+		if handler.templates[template.Team] == nil {
+			handler.templates[template.Team] = make(map[string]builds.Template)
+		}
+
+		handler.templates[template.Team][template.Name] = template
+	}
+	handler.templatesMutex.Unlock()
+
+	handler.logger.Info("restored", lager.Data{
+		"builds":    len(saved),
+		"resealed":  resealed,
+		"templates": len(templates),
+	})
+
+	return nil
+}
+
+func (handler *Handler) saveBuild(log lager.Logger, build *builds.Build) {
+	handler.buildsMutex.RLock()
+	saved := store.NewBuild(*build)
+	handler.buildsMutex.RUnlock()
+
+	err := handler.store.SaveBuild(saved)
+	if err != nil {
+		log.Error("failed-to-save-build", err)
+	}
+}
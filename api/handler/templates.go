@@ -0,0 +1,310 @@
+package handler
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"time"
+
+	TurbineBuilds "github.com/concourse/turbine/api/builds"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/concourse/glider/api/builds"
+	"github.com/concourse/glider/auth"
+	"github.com/concourse/glider/policy"
+)
+
+// rule reported for builds that cannot be created from their template
+const ruleTemplate = "template"
+
+// placeholderPattern matches ((name)) placeholders in template configs.
+var placeholderPattern = regexp.MustCompile(`\(\(([a-zA-Z0-9_.-]+)\)\)`)
+
+var templateNamePattern = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]*$`)
+
+// GetTemplates lists the caller's team's templates, by name.
+func (handler *Handler) GetTemplates(w http.ResponseWriter, r *http.Request) {
+	team := auth.IdentityFrom(r).Team
+
+	templates := []builds.Template{}
+
+	handler.templatesMutex.RLock()
+	for _, template := range handler.templates[team] {
+		templates = append(templates, template.Redacted())
+	}
+	handler.templatesMutex.RUnlock()
+
+	sort.Sort(templatesByName(templates))
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(templates)
+}
+
+func (handler *Handler) GetTemplate(w http.ResponseWriter, r *http.Request) {
+	name := r.FormValue(":name")
+
+	template, found := handler.lookupTemplate(auth.IdentityFrom(r).Team, name)
+	if !found {
+		writeTemplateNotFound(w, name)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(template.Redacted())
+}
+
+// SaveTemplate creates or replaces one of the caller's team's templates.
+func (handler *Handler) SaveTemplate(w http.ResponseWriter, r *http.Request) {
+	name := r.FormValue(":name")
+	identity := auth.IdentityFrom(r)
+
+	if !templateNamePattern.MatchString(name) {
+		writeError(w, http.StatusBadRequest, builds.ErrorMalformedRequest, "invalid template name: "+name, nil)
+		return
+	}
+
+	var template builds.Template
+	err := json.NewDecoder(r.Body).Decode(&template)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, builds.ErrorMalformedRequest, "malformed template: "+err.Error(), nil)
+		return
+	}
+
+	template.Name = name
+	template.Team = identity.Team
+	template.Placeholders = placeholders(template.Config)
+	template.UpdatedBy = identity.User
+	template.UpdatedAt = time.Now()
+
+	secretParams := templateSecrets(template)
+
+	invalid := validateSecretParams(secretParams)
+	if len(invalid) > 0 {
+		writeError(w, http.StatusBadRequest, builds.ErrorInvalidBuild, "invalid template", invalid)
+		return
+	}
+
+	// placeholders within secret params are found above, before sealing
+	err = handler.sealSecrets(&secretParams)
+	if err != nil {
+		handler.logger.Error("failed-to-encrypt-secrets", err)
+		writeInternalError(w, err)
+		return
+	}
+
+	template.Config = secretParams.Config
+
+	handler.logger.Info("save-template", lager.Data{
+		"template": template.Redacted(),
+	})
+
+	err = handler.store.SaveTemplate(template)
+	if err != nil {
+		handler.logger.Error("failed-to-save-template", err)
+		writeInternalError(w, err)
+		return
+	}
+
+	handler.templatesMutex.Lock()
+	templates, found := handler.templates[template.Team]
+	if !found {
+		templates = make(map[string]builds.Template)
+		handler.templates[template.Team] = templates
+	}
+
+	_, replaced := templates[name]
+	templates[name] = template
+	handler.templatesMutex.Unlock()
+
+	if replaced {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusCreated)
+	}
+
+	json.NewEncoder(w).Encode(template.Redacted())
+}
+
+// DeleteTemplate removes one of the caller's team's templates. Builds already
+// created from it are unaffected.
+func (handler *Handler) DeleteTemplate(w http.ResponseWriter, r *http.Request) {
+	name := r.FormValue(":name")
+	identity := auth.IdentityFrom(r)
+
+	_, found := handler.lookupTemplate(identity.Team, name)
+	if !found {
+		writeTemplateNotFound(w, name)
+		return
+	}
+
+	handler.logger.Info("delete-template", lager.Data{
+		"team": identity.Team,
+		"name": name,
+		"by":   identity.User,
+	})
+
+	err := handler.store.DeleteTemplate(identity.Team, name)
+	if err != nil {
+		handler.logger.Error("failed-to-delete-template", err)
+		writeInternalError(w, err)
+		return
+	}
+
+	handler.templatesMutex.Lock()
+	delete(handler.templates[identity.Team], name)
+	handler.templatesMutex.Unlock()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (handler *Handler) lookupTemplate(team string, name string) (builds.Template, bool) {
+	handler.templatesMutex.RLock()
+	defer handler.templatesMutex.RUnlock()
+
+	template, found := handler.templates[team][name]
+	return template, found
+}
+
+// applyTemplate merges the build's config onto that of its template, if it
+// has one, and fills in the template's placeholders from the build's
+// template params. It returns every problem doing so, such as placeholders
+// left unfilled. The template's secret params are decrypted into the build,
+// which must be sealed again before it is kept.
+func (handler *Handler) applyTemplate(team string, build *builds.Build) ([]policy.Violation, error) {
+	if build.Template == "" {
+		return nil, nil
+	}
+
+	template, found := handler.lookupTemplate(team, build.Template)
+	if !found {
+		return []policy.Violation{{
+			Rule:    ruleTemplate,
+			Message: "template '" + build.Template + "' not found",
+		}}, nil
+	}
+
+	unsealed, err := handler.unsealSecrets(templateSecrets(template))
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %s", template.Name, err)
+	}
+
+	template.Config = unsealed.Config
+
+	violations := []policy.Violation{}
+
+	for _, name := range template.Placeholders {
+		if _, found := build.TemplateParams[name]; !found {
+			violations = append(violations, policy.Violation{
+				Rule:    ruleTemplate,
+				Message: "missing template param: " + name,
+			})
+		}
+	}
+
+	used := make(map[string]bool, len(template.Placeholders))
+	for _, name := range template.Placeholders {
+		used[name] = true
+	}
+
+	unknown := []string{}
+	for name := range build.TemplateParams {
+		if !used[name] {
+			unknown = append(unknown, name)
+		}
+	}
+
+	sort.Strings(unknown)
+
+	for _, name := range unknown {
+		violations = append(violations, policy.Violation{
+			Rule:    ruleTemplate,
+			Message: "unknown template param: " + name,
+		})
+	}
+
+	config := fillPlaceholders(template.Config, build.TemplateParams)
+
+	build.Config = config.Merge(build.Config)
+	build.SecretParams = append(append([]string{}, template.SecretParams...), build.SecretParams...)
+
+	// the values may well be secret, and have served their purpose
+	build.TemplateParams = nil
+
+	return violations, nil
+}
+
+// placeholders returns the sorted names of the placeholders in the config.
+func placeholders(config TurbineBuilds.Config) []string {
+	found := map[string]bool{}
+
+	eachValue(config, func(value string) string {
+		for _, match := range placeholderPattern.FindAllStringSubmatch(value, -1) {
+			found[match[1]] = true
+		}
+
+		return value
+	})
+
+	names := []string{}
+	for name := range found {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// fillPlaceholders returns a copy of the config with its placeholders
+// replaced by the given values. Placeholders without a value are left as
+// they are.
+func fillPlaceholders(config TurbineBuilds.Config, values map[string]string) TurbineBuilds.Config {
+	return eachValue(config, func(value string) string {
+		return placeholderPattern.ReplaceAllStringFunc(value, func(placeholder string) string {
+			filled, found := values[placeholderPattern.FindStringSubmatch(placeholder)[1]]
+			if !found {
+				return placeholder
+			}
+
+			return filled
+		})
+	})
+}
+
+// eachValue returns a copy of the config with every value that may contain
+// placeholders passed through the function.
+func eachValue(config TurbineBuilds.Config, fn func(string) string) TurbineBuilds.Config {
+	config.Image = fn(config.Image)
+	config.Run.Path = fn(config.Run.Path)
+
+	if config.Run.Args != nil {
+		args := make([]string, len(config.Run.Args))
+		for i, arg := range config.Run.Args {
+			args[i] = fn(arg)
+		}
+
+		config.Run.Args = args
+	}
+
+	if config.Params != nil {
+		params := make(map[string]string, len(config.Params))
+		for name, value := range config.Params {
+			params[name] = fn(value)
+		}
+
+		config.Params = params
+	}
+
+	if config.Paths != nil {
+		paths := make(map[string]string, len(config.Paths))
+		for name, value := range config.Paths {
+			paths[name] = fn(value)
+		}
+
+		config.Paths = paths
+	}
+
+	return config
+}
@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"mime"
+	"net/http"
+
+	TurbineBuilds "github.com/concourse/turbine/api/builds"
+	"gopkg.in/yaml.v2"
+
+	"github.com/concourse/glider/api/builds"
+	"github.com/concourse/glider/auth"
+	"github.com/concourse/glider/policy"
+)
+
+// rule reported for fields of a YAML config that turbine does not know
+const ruleConfig = "config"
+
+var yamlContentTypes = map[string]bool{
+	"application/x-yaml": true,
+	"application/yaml":   true,
+	"text/yaml":          true,
+	"text/x-yaml":        true,
+}
+
+// ValidateBuild checks a build as CreateBuild would, reporting every problem
+// with it and every policy rule it violates, without creating anything. The
+// body is either a build, as JSON, or a build.yml, as YAML.
+func (handler *Handler) ValidateBuild(w http.ResponseWriter, r *http.Request) {
+	build, invalid, err := decodeBuild(r)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, builds.ErrorMalformedRequest, "malformed build: "+err.Error(), nil)
+		return
+	}
+
+	identity := auth.IdentityFrom(r)
+
+	templateInvalid, err := handler.applyTemplate(identity.Team, &build)
+	if err != nil {
+		handler.logger.Error("failed-to-apply-template", err)
+		writeInternalError(w, err)
+		return
+	}
+
+	invalid = append(invalid, templateInvalid...)
+	invalid = append(invalid, handler.validateBuild(build)...)
+	denied := handler.policy.Check(identity, build)
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(builds.Validation{
+		Valid:   len(invalid) == 0 && len(denied) == 0,
+		Invalid: problems(invalid),
+		Denied:  problems(denied),
+	})
+}
+
+// decodeBuild reads the build from the request body. Fields of a YAML config
+// that turbine would ignore are reported as violations rather than errors,
+// so that they can be fixed along with everything else.
+func decodeBuild(r *http.Request) (builds.Build, []policy.Violation, error) {
+	var build builds.Build
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if !yamlContentTypes[mediaType] {
+		err := json.NewDecoder(r.Body).Decode(&build)
+		return build, nil, err
+	}
+
+	payload, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		return build, nil, err
+	}
+
+	var config TurbineBuilds.Config
+	err = yaml.UnmarshalStrict(payload, &config)
+
+	build.Config = config
+
+	typeErr, ok := err.(*yaml.TypeError)
+	if !ok {
+		return build, nil, err
+	}
+
+	violations := []policy.Violation{}
+	for _, message := range typeErr.Errors {
+		violations = append(violations, policy.Violation{
+			Rule:    ruleConfig,
+			Message: message,
+		})
+	}
+
+	return build, violations, nil
+}
+
+func problems(violations []policy.Violation) []builds.Problem {
+	problems := make([]builds.Problem, len(violations))
+	for i, violation := range violations {
+		problems[i] = builds.Problem{
+			Rule:    violation.Rule,
+			Message: violation.Message,
+		}
+	}
+
+	return problems
+}
@@ -0,0 +1,31 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/concourse/glider/api/builds"
+	"github.com/concourse/glider/webhooks"
+)
+
+func (handler *Handler) GetDeliveries(w http.ResponseWriter, r *http.Request) {
+	guid := r.FormValue(":guid")
+
+	_, found := handler.lookupBuild(r, guid)
+
+	if !found {
+		writeBuildNotFound(w, guid)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(handler.notifier.Deliveries(guid))
+}
+
+func (handler *Handler) notify(event webhooks.Event, build *builds.Build) {
+	handler.buildsMutex.RLock()
+	snapshot := *build
+	handler.buildsMutex.RUnlock()
+
+	handler.notifier.Notify(event, snapshot.Redacted())
+}
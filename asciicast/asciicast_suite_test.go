@@ -0,0 +1,13 @@
+package asciicast_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"testing"
+)
+
+func TestAsciicast(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "Asciicast Suite")
+}
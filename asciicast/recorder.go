@@ -0,0 +1,125 @@
+// Package asciicast records terminal sessions in the asciicast v2 format, as
+// played back by asciinema.
+package asciicast
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+const ContentType = "application/x-asciicast"
+
+type header struct {
+	Version   int   `json:"version"`
+	Width     int   `json:"width"`
+	Height    int   `json:"height"`
+	Timestamp int64 `json:"timestamp"`
+}
+
+const (
+	eventInput  = "i"
+	eventOutput = "o"
+)
+
+// Recorder accumulates a session's transcript in memory, up to a maximum
+// size. It is safe for concurrent use.
+type Recorder struct {
+	startedAt time.Time
+
+	// 0 means no limit
+	maxSize int
+
+	// set once an event did not fit; no further events are recorded, so
+	// that the transcript never skips ahead
+	truncated bool
+
+	buffer *bytes.Buffer
+	mutex  *sync.Mutex
+}
+
+// NewRecorder starts a transcript for a terminal of the given size. Once the
+// transcript would grow beyond maxSize bytes, recording stops; 0 means no
+// limit.
+func NewRecorder(width int, height int, startedAt time.Time, maxSize int) *Recorder {
+	buffer := new(bytes.Buffer)
+
+	json.NewEncoder(buffer).Encode(header{
+		Version:   2,
+		Width:     width,
+		Height:    height,
+		Timestamp: startedAt.Unix(),
+	})
+
+	return &Recorder{
+		startedAt: startedAt,
+
+		maxSize: maxSize,
+
+		buffer: buffer,
+		mutex:  new(sync.Mutex),
+	}
+}
+
+// Input returns a writer that records everything written to it as input.
+func (recorder *Recorder) Input() io.Writer {
+	return eventWriter{recorder, eventInput}
+}
+
+// Output returns a writer that records everything written to it as output.
+func (recorder *Recorder) Output() io.Writer {
+	return eventWriter{recorder, eventOutput}
+}
+
+// Bytes returns the transcript recorded so far.
+func (recorder *Recorder) Bytes() []byte {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	return append([]byte{}, recorder.buffer.Bytes()...)
+}
+
+// Truncated returns true if recording stopped for reaching the maximum size.
+func (recorder *Recorder) Truncated() bool {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	return recorder.truncated
+}
+
+func (recorder *Recorder) record(eventType string, data string) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	if recorder.truncated {
+		return
+	}
+
+	elapsed := time.Since(recorder.startedAt).Seconds()
+
+	event, err := json.Marshal([]interface{}{elapsed, eventType, data})
+	if err != nil {
+		return
+	}
+
+	event = append(event, '\n')
+
+	if recorder.maxSize > 0 && recorder.buffer.Len()+len(event) > recorder.maxSize {
+		recorder.truncated = true
+		return
+	}
+
+	recorder.buffer.Write(event)
+}
+
+type eventWriter struct {
+	recorder  *Recorder
+	eventType string
+}
+
+func (writer eventWriter) Write(data []byte) (int, error) {
+	writer.recorder.record(writer.eventType, string(data))
+	return len(data), nil
+}
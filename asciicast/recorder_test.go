@@ -0,0 +1,88 @@
+package asciicast_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/concourse/glider/asciicast"
+)
+
+var _ = Describe("Recorder", func() {
+	var startedAt time.Time
+	var recorder *Recorder
+
+	lines := func() []interface{} {
+		decoder := json.NewDecoder(bytes.NewReader(recorder.Bytes()))
+
+		lines := []interface{}{}
+		for decoder.More() {
+			var line interface{}
+			err := decoder.Decode(&line)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			lines = append(lines, line)
+		}
+
+		return lines
+	}
+
+	BeforeEach(func() {
+		startedAt = time.Now()
+		recorder = NewRecorder(80, 24, startedAt, 0)
+	})
+
+	It("starts with a v2 header", func() {
+		Ω(lines()).Should(Equal([]interface{}{
+			map[string]interface{}{
+				"version":   float64(2),
+				"width":     float64(80),
+				"height":    float64(24),
+				"timestamp": float64(startedAt.Unix()),
+			},
+		}))
+	})
+
+	It("records input and output as timed events", func() {
+		fmt.Fprintf(recorder.Input(), "ls\n")
+		fmt.Fprintf(recorder.Output(), "bin etc\n")
+
+		events := lines()[1:]
+		Ω(events).Should(HaveLen(2))
+
+		for i, event := range events {
+			Ω(event).Should(HaveLen(3))
+			Ω(event.([]interface{})[0]).Should(BeNumerically(">=", 0))
+
+			if i > 0 {
+				Ω(event.([]interface{})[0]).Should(BeNumerically(">=", events[i-1].([]interface{})[0]))
+			}
+		}
+
+		Ω(events[0].([]interface{})[1:]).Should(Equal([]interface{}{"i", "ls\n"}))
+		Ω(events[1].([]interface{})[1:]).Should(Equal([]interface{}{"o", "bin etc\n"}))
+	})
+
+	Context("with a maximum size", func() {
+		BeforeEach(func() {
+			recorder = NewRecorder(80, 24, startedAt, 100)
+		})
+
+		It("stops recording once an event would not fit", func() {
+			fmt.Fprintf(recorder.Output(), "ok\n")
+			Ω(recorder.Truncated()).Should(BeFalse())
+
+			fmt.Fprintf(recorder.Output(), "%s\n", bytes.Repeat([]byte("x"), 100))
+			Ω(recorder.Truncated()).Should(BeTrue())
+
+			fmt.Fprintf(recorder.Output(), "ok\n")
+
+			Ω(len(recorder.Bytes())).Should(BeNumerically("<=", 100))
+			Ω(lines()).Should(HaveLen(2))
+		})
+	})
+})
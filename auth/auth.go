@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+	"os"
+)
+
+type Identity struct {
+	User  string `json:"user,omitempty"`
+	Team  string `json:"team,omitempty"`
+	Admin bool   `json:"admin,omitempty"`
+}
+
+// CanAccess returns true if the identity may see and act on builds owned by
+// the team. Admins may access every team's builds.
+func (identity Identity) CanAccess(team string) bool {
+	return identity.Admin || identity.Team == team
+}
+
+type Authenticator interface {
+	Authenticate(*http.Request) (Identity, bool)
+}
+
+type User struct {
+	Name     string `json:"name"`
+	Password string `json:"password"`
+	Team     string `json:"team"`
+	Admin    bool   `json:"admin"`
+}
+
+// NoopAuthenticator lets every request through anonymously. Anonymous
+// callers are only admins if Admin is set.
+type NoopAuthenticator struct {
+	Admin bool
+}
+
+func (authenticator NoopAuthenticator) Authenticate(*http.Request) (Identity, bool) {
+	return Identity{Admin: authenticator.Admin}, true
+}
+
+type BasicAuthenticator struct {
+	users map[string]User
+}
+
+func NewBasicAuthenticator(users []User) BasicAuthenticator {
+	byName := make(map[string]User, len(users))
+	for _, user := range users {
+		byName[user.Name] = user
+	}
+
+	return BasicAuthenticator{users: byName}
+}
+
+// LoadUsers reads a JSON list of users, each with a name, password, team,
+// and whether they are an admin.
+func LoadUsers(path string) (BasicAuthenticator, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return BasicAuthenticator{}, err
+	}
+
+	defer file.Close()
+
+	var users []User
+	err = json.NewDecoder(file).Decode(&users)
+	if err != nil {
+		return BasicAuthenticator{}, err
+	}
+
+	return NewBasicAuthenticator(users), nil
+}
+
+func (authenticator BasicAuthenticator) Authenticate(r *http.Request) (Identity, bool) {
+	name, password, ok := r.BasicAuth()
+	if !ok {
+		return Identity{}, false
+	}
+
+	user, found := authenticator.users[name]
+	if !found {
+		return Identity{}, false
+	}
+
+	if subtle.ConstantTimeCompare([]byte(user.Password), []byte(password)) != 1 {
+		return Identity{}, false
+	}
+
+	return Identity{User: user.Name, Team: user.Team, Admin: user.Admin}, true
+}
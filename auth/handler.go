@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/concourse/glider/api/builds"
+)
+
+type identityKey struct{}
+
+type authHandler struct {
+	handler       http.Handler
+	authenticator Authenticator
+}
+
+// Handler rejects requests that fail authentication and otherwise makes the
+// caller's identity available to the wrapped handler via IdentityFrom.
+func Handler(handler http.Handler, authenticator Authenticator) http.Handler {
+	return authHandler{
+		handler:       handler,
+		authenticator: authenticator,
+	}
+}
+
+func (h authHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	identity, ok := h.authenticator.Authenticate(r)
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Basic realm="glider"`)
+		writeError(w, http.StatusUnauthorized, builds.ErrorUnauthorized, "not authorized")
+		return
+	}
+
+	h.handler.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), identityKey{}, identity)))
+}
+
+type adminHandler struct {
+	handler http.Handler
+}
+
+// RequireAdmin rejects requests from callers who are not admins. It must be
+// wrapped by Handler.
+func RequireAdmin(handler http.Handler) http.Handler {
+	return adminHandler{handler: handler}
+}
+
+func (h adminHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !IdentityFrom(r).Admin {
+		writeError(w, http.StatusForbidden, builds.ErrorForbidden, "admin access required")
+		return
+	}
+
+	h.handler.ServeHTTP(w, r)
+}
+
+func IdentityFrom(r *http.Request) Identity {
+	identity, _ := r.Context().Value(identityKey{}).(Identity)
+	return identity
+}
+
+func writeError(w http.ResponseWriter, status int, code string, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+
+	json.NewEncoder(w).Encode(builds.ErrorResponse{
+		Error: builds.Error{
+			Code:    code,
+			Message: message,
+		},
+	})
+}
@@ -0,0 +1,339 @@
+package client
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/tedsuo/rata"
+
+	"github.com/concourse/glider/api/builds"
+	"github.com/concourse/glider/routes"
+)
+
+type Client interface {
+	CreateBuild(builds.Build) (builds.Build, error)
+	ValidateBuild(builds.Build) (builds.Validation, error)
+	GetBuilds() ([]builds.Build, error)
+
+	UploadBits(guid string, bits io.Reader) error
+
+	StreamLogs(guid string) (<-chan *json.RawMessage, io.Closer, error)
+	Hijack(guid string, spec interface{}) (net.Conn, error)
+	Abort(guid string, reason string) error
+
+	GetResult(guid string) (builds.BuildResult, error)
+}
+
+// Error is returned when glider responds with an error status.
+type Error struct {
+	StatusCode int
+
+	Code    string
+	Message string
+	Details interface{}
+}
+
+func (err Error) Error() string {
+	if err.Message == "" {
+		return fmt.Sprintf("glider responded with %d", err.StatusCode)
+	}
+
+	return fmt.Sprintf("glider responded with %d: %s", err.StatusCode, err.Message)
+}
+
+type client struct {
+	apiURL *url.URL
+
+	requestGenerator *rata.RequestGenerator
+	httpClient       *http.Client
+}
+
+// New constructs a client for the glider at the given URL. Basic auth
+// credentials may be provided as the URL's userinfo.
+func New(apiURL string) (Client, error) {
+	parsedURL, err := url.Parse(apiURL)
+	if err != nil {
+		return nil, err
+	}
+
+	host := *parsedURL
+	host.User = nil
+
+	return &client{
+		apiURL: parsedURL,
+
+		requestGenerator: rata.NewRequestGenerator(host.String(), routes.Routes),
+		httpClient: &http.Client{
+			Transport: &http.Transport{},
+		},
+	}, nil
+}
+
+func (client *client) CreateBuild(build builds.Build) (builds.Build, error) {
+	payload, err := json.Marshal(build)
+	if err != nil {
+		return builds.Build{}, err
+	}
+
+	var created builds.Build
+	err = client.do(routes.CreateBuild, nil, bytes.NewBuffer(payload), "application/json", http.StatusCreated, &created)
+	if err != nil {
+		return builds.Build{}, err
+	}
+
+	return created, nil
+}
+
+// ValidateBuild reports every problem that would stop the build from being
+// created, without creating it.
+func (client *client) ValidateBuild(build builds.Build) (builds.Validation, error) {
+	payload, err := json.Marshal(build)
+	if err != nil {
+		return builds.Validation{}, err
+	}
+
+	var validation builds.Validation
+	err = client.do(routes.ValidateBuild, nil, bytes.NewBuffer(payload), "application/json", http.StatusOK, &validation)
+	if err != nil {
+		return builds.Validation{}, err
+	}
+
+	return validation, nil
+}
+
+func (client *client) GetBuilds() ([]builds.Build, error) {
+	var result []builds.Build
+	err := client.do(routes.GetBuilds, nil, nil, "", http.StatusOK, &result)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (client *client) UploadBits(guid string, bits io.Reader) error {
+	return client.do(routes.UploadBits, rata.Params{"guid": guid}, bits, "application/octet-stream", http.StatusCreated, nil)
+}
+
+// Abort aborts the build, recording the reason, which may be empty.
+func (client *client) Abort(guid string, reason string) error {
+	payload, err := json.Marshal(builds.AbortRequest{Reason: reason})
+	if err != nil {
+		return err
+	}
+
+	return client.do(routes.AbortBuild, rata.Params{"guid": guid}, bytes.NewBuffer(payload), "application/json", http.StatusOK, nil)
+}
+
+func (client *client) GetResult(guid string) (builds.BuildResult, error) {
+	var result builds.BuildResult
+	err := client.do(routes.GetResult, rata.Params{"guid": guid}, nil, "", http.StatusOK, &result)
+	if err != nil {
+		return builds.BuildResult{}, err
+	}
+
+	return result, nil
+}
+
+// StreamLogs returns the build's log events, starting from the beginning. The
+// channel is closed when the build's log ends, the connection is lost, or the
+// returned closer is closed, which must be done if the caller stops reading
+// before then.
+func (client *client) StreamLogs(guid string) (<-chan *json.RawMessage, io.Closer, error) {
+	req, err := client.createRequest(routes.LogOutput, rata.Params{"guid": guid}, nil, "")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logURL := *req.URL
+	if logURL.Scheme == "https" {
+		logURL.Scheme = "wss"
+	} else {
+		logURL.Scheme = "ws"
+	}
+
+	conn, resp, err := websocket.DefaultDialer.Dial(logURL.String(), req.Header)
+	if err == websocket.ErrBadHandshake {
+		return nil, nil, responseError(resp)
+	}
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stream := &logStream{
+		conn:     conn,
+		stopping: make(chan struct{}),
+		once:     new(sync.Once),
+	}
+
+	events := make(chan *json.RawMessage)
+
+	go func() {
+		defer close(events)
+		defer conn.Close()
+
+		for {
+			var event *json.RawMessage
+			err := conn.ReadJSON(&event)
+			if err != nil {
+				return
+			}
+
+			select {
+			case events <- event:
+			case <-stream.stopping:
+				return
+			}
+		}
+	}()
+
+	return events, stream, nil
+}
+
+// logStream stops streaming logs when closed, whether or not the events are
+// still being read.
+type logStream struct {
+	conn     *websocket.Conn
+	stopping chan struct{}
+	once     *sync.Once
+}
+
+func (stream *logStream) Close() error {
+	stream.once.Do(func() {
+		close(stream.stopping)
+	})
+
+	return stream.conn.Close()
+}
+
+// Hijack runs a process in the build's container as described by spec,
+// returning a connection attached to its stdin and stdout.
+func (client *client) Hijack(guid string, spec interface{}) (net.Conn, error) {
+	payload, err := json.Marshal(spec)
+	if err != nil {
+		return nil, err
+	}
+
+	req, err := client.createRequest(routes.HijackBuild, rata.Params{"guid": guid}, bytes.NewBuffer(payload), "application/json")
+	if err != nil {
+		return nil, err
+	}
+
+	var conn net.Conn
+	if req.URL.Scheme == "https" {
+		conn, err = tls.Dial("tcp", hostPort(req.URL, "443"), nil)
+	} else {
+		conn, err = net.Dial("tcp", hostPort(req.URL, "80"))
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	clientConn := httputil.NewClientConn(conn, nil)
+
+	resp, err := clientConn.Do(req)
+	if err != nil && err != httputil.ErrPersistEOF {
+		conn.Close()
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		defer conn.Close()
+		return nil, responseError(resp)
+	}
+
+	hijackedConn, br := clientConn.Hijack()
+
+	return &bufferedConn{Conn: hijackedConn, reader: br}, nil
+}
+
+func (client *client) createRequest(name string, params rata.Params, body io.Reader, contentType string) (*http.Request, error) {
+	req, err := client.requestGenerator.CreateRequest(name, params, body)
+	if err != nil {
+		return nil, err
+	}
+
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	if client.apiURL.User != nil {
+		password, _ := client.apiURL.User.Password()
+		req.SetBasicAuth(client.apiURL.User.Username(), password)
+	}
+
+	return req, nil
+}
+
+func (client *client) do(
+	name string,
+	params rata.Params,
+	body io.Reader,
+	contentType string,
+	expectedStatus int,
+	response interface{},
+) error {
+	req, err := client.createRequest(name, params, body, contentType)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != expectedStatus {
+		return responseError(resp)
+	}
+
+	if response == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(response)
+}
+
+func responseError(resp *http.Response) error {
+	var errResponse builds.ErrorResponse
+	json.NewDecoder(resp.Body).Decode(&errResponse)
+
+	return Error{
+		StatusCode: resp.StatusCode,
+
+		Code:    errResponse.Error.Code,
+		Message: errResponse.Error.Message,
+		Details: errResponse.Error.Details,
+	}
+}
+
+func hostPort(u *url.URL, defaultPort string) string {
+	if u.Port() != "" {
+		return u.Host
+	}
+
+	return net.JoinHostPort(u.Hostname(), defaultPort)
+}
+
+type bufferedConn struct {
+	net.Conn
+	reader *bufio.Reader
+}
+
+func (conn *bufferedConn) Read(b []byte) (int, error) {
+	return conn.reader.Read(b)
+}
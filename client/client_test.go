@@ -0,0 +1,401 @@
+package client_test
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+	"github.com/onsi/gomega/ghttp"
+	"github.com/pivotal-golang/lager/lagertest"
+
+	"github.com/concourse/glider/api"
+	"github.com/concourse/glider/api/builds"
+	"github.com/concourse/glider/auth"
+	. "github.com/concourse/glider/client"
+	"github.com/concourse/glider/drain"
+	"github.com/concourse/glider/store"
+	"github.com/concourse/glider/webhooks"
+	TurbineBuilds "github.com/concourse/turbine/api/builds"
+)
+
+var _ = Describe("Client", func() {
+	var turbineServer *ghttp.Server
+	var server *httptest.Server
+
+	var client Client
+
+	BeforeEach(func() {
+		turbineServer = ghttp.NewServer()
+
+		handler, err := api.New(api.Config{
+			Logger: lagertest.NewTestLogger("test"),
+
+			PeerAddr:   "peer-addr",
+			TurbineURL: turbineServer.URL(),
+
+			Authenticator: auth.NewBasicAuthenticator([]auth.User{
+				{Name: "alice", Password: "pass", Team: "core"},
+			}),
+			Store: store.NewMemoryStore(),
+
+			Drainer:  drain.NewDrainer(time.Second),
+			Notifier: webhooks.NewNotifier(lagertest.NewTestLogger("webhooks"), nil, "", 1, 0),
+		})
+		Ω(err).ShouldNot(HaveOccurred())
+
+		server = httptest.NewServer(handler)
+
+		client, err = New(strings.Replace(server.URL, "http://", "http://alice:pass@", 1))
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	AfterEach(func() {
+		server.Close()
+		turbineServer.Close()
+	})
+
+	someBuild := builds.Build{
+		Name: "some-name",
+		Config: TurbineBuilds.Config{
+			Image: "ubuntu",
+		},
+	}
+
+	// triggers the build, with turbine fetching the bits and responding with
+	// the given build
+	trigger := func(guid string, turbineBuild TurbineBuilds.Build) {
+		turbineServer.AppendHandlers(
+			ghttp.CombineHandlers(
+				ghttp.VerifyRequest("POST", "/builds"),
+				ghttp.RespondWithJSONEncoded(201, turbineBuild),
+			),
+		)
+
+		go http.Get(server.URL + "/builds/" + guid + "/bits")
+
+		err := client.UploadBits(guid, bytes.NewBufferString("some-bits"))
+		Ω(err).ShouldNot(HaveOccurred())
+	}
+
+	Describe("CreateBuild", func() {
+		It("returns the created build", func() {
+			build, err := client.CreateBuild(someBuild)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(build.Guid).ShouldNot(BeEmpty())
+			Ω(build.Name).Should(Equal("some-name"))
+			Ω(build.Config).Should(Equal(someBuild.Config))
+		})
+
+		Context("when the build is invalid", func() {
+			It("returns an error describing the problem", func() {
+				_, err := client.CreateBuild(builds.Build{})
+				Ω(err).Should(HaveOccurred())
+
+				apiErr, ok := err.(Error)
+				Ω(ok).Should(BeTrue())
+				Ω(apiErr.StatusCode).Should(Equal(http.StatusBadRequest))
+				Ω(apiErr.Code).Should(Equal(builds.ErrorInvalidBuild))
+			})
+		})
+
+		Context("with bad credentials", func() {
+			BeforeEach(func() {
+				var err error
+				client, err = New(strings.Replace(server.URL, "http://", "http://alice:wrong@", 1))
+				Ω(err).ShouldNot(HaveOccurred())
+			})
+
+			It("returns an unauthorized error", func() {
+				_, err := client.CreateBuild(someBuild)
+				Ω(err).Should(HaveOccurred())
+
+				apiErr, ok := err.(Error)
+				Ω(ok).Should(BeTrue())
+				Ω(apiErr.StatusCode).Should(Equal(http.StatusUnauthorized))
+				Ω(apiErr.Code).Should(Equal(builds.ErrorUnauthorized))
+			})
+		})
+	})
+
+	Describe("ValidateBuild", func() {
+		It("reports every problem without creating the build", func() {
+			validation, err := client.ValidateBuild(builds.Build{
+				Notify: []string{"ftp://example.com"},
+			})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(validation.Valid).Should(BeFalse())
+			Ω(validation.Invalid).Should(HaveLen(2))
+
+			allBuilds, err := client.GetBuilds()
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(allBuilds).Should(BeEmpty())
+		})
+
+		It("reports a valid build as valid", func() {
+			validation, err := client.ValidateBuild(someBuild)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(validation.Valid).Should(BeTrue())
+			Ω(validation.Invalid).Should(BeEmpty())
+			Ω(validation.Denied).Should(BeEmpty())
+		})
+	})
+
+	Describe("GetBuilds", func() {
+		It("returns every build, most recent first", func() {
+			first, err := client.CreateBuild(someBuild)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			second, err := client.CreateBuild(someBuild)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			allBuilds, err := client.GetBuilds()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(allBuilds).Should(HaveLen(2))
+			Ω(allBuilds[0].Guid).Should(Equal(second.Guid))
+			Ω(allBuilds[1].Guid).Should(Equal(first.Guid))
+		})
+	})
+
+	Describe("UploadBits", func() {
+		var build builds.Build
+
+		BeforeEach(func() {
+			var err error
+			build, err = client.CreateBuild(someBuild)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("streams the bits to turbine", func() {
+			fetched := make(chan string, 1)
+
+			turbineServer.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/builds"),
+					ghttp.RespondWithJSONEncoded(201, TurbineBuilds.Build{}),
+				),
+			)
+
+			go func() {
+				defer GinkgoRecover()
+
+				resp, err := http.Get(server.URL + "/builds/" + build.Guid + "/bits")
+				Ω(err).ShouldNot(HaveOccurred())
+
+				body, err := ioutil.ReadAll(resp.Body)
+				Ω(err).ShouldNot(HaveOccurred())
+
+				fetched <- string(body)
+			}()
+
+			err := client.UploadBits(build.Guid, bytes.NewBufferString("some-bits"))
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Eventually(fetched).Should(Receive(Equal("some-bits")))
+		})
+
+		Context("when turbine fails", func() {
+			BeforeEach(func() {
+				turbineServer.AppendHandlers(ghttp.RespondWith(500, "oh no"))
+			})
+
+			It("returns an error including turbine's status", func() {
+				err := client.UploadBits(build.Guid, bytes.NewBufferString("some-bits"))
+				Ω(err).Should(HaveOccurred())
+
+				apiErr, ok := err.(Error)
+				Ω(ok).Should(BeTrue())
+				Ω(apiErr.Code).Should(Equal(builds.ErrorTurbineRejected))
+				Ω(apiErr.Details).Should(HaveKeyWithValue("upstream_status", BeNumerically("==", 500)))
+			})
+		})
+	})
+
+	Describe("StreamLogs", func() {
+		var build builds.Build
+		var input *websocket.Conn
+
+		BeforeEach(func() {
+			var err error
+			build, err = client.CreateBuild(someBuild)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			input, _, err = websocket.DefaultDialer.Dial(
+				fmt.Sprintf("ws://%s/builds/%s/log/input", server.Listener.Addr(), build.Guid),
+				nil,
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			err = input.WriteJSON("hello")
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("emits the build's log events until the log ends", func() {
+			events, stream, err := client.StreamLogs(build.Guid)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			defer stream.Close()
+
+			var event *json.RawMessage
+			Eventually(events).Should(Receive(&event))
+			Ω(string(*event)).Should(Equal(`"hello"`))
+
+			input.Close()
+
+			Eventually(events).Should(BeClosed())
+		})
+
+		It("stops when closed, even if the events are not being read", func() {
+			events, stream, err := client.StreamLogs(build.Guid)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			// give the stream time to block on handing over the first event
+			time.Sleep(100 * time.Millisecond)
+
+			err = stream.Close()
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Eventually(func() bool {
+				select {
+				case _, ok := <-events:
+					return !ok
+				default:
+					return false
+				}
+			}).Should(BeTrue())
+		})
+
+		Context("when the build does not exist", func() {
+			It("returns an error", func() {
+				_, _, err := client.StreamLogs("bogus")
+				Ω(err).Should(HaveOccurred())
+
+				apiErr, ok := err.(Error)
+				Ω(ok).Should(BeTrue())
+				Ω(apiErr.Code).Should(Equal(builds.ErrorBuildNotFound))
+			})
+		})
+	})
+
+	Describe("Hijack", func() {
+		var build builds.Build
+
+		BeforeEach(func() {
+			var err error
+			build, err = client.CreateBuild(someBuild)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			trigger(build.Guid, TurbineBuilds.Build{
+				HijackURL: turbineServer.URL() + "/hijack",
+			})
+
+			turbineServer.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/hijack"),
+					func(w http.ResponseWriter, r *http.Request) {
+						var spec map[string]string
+						err := json.NewDecoder(r.Body).Decode(&spec)
+						Ω(err).ShouldNot(HaveOccurred())
+						Ω(spec).Should(Equal(map[string]string{"path": "bash"}))
+
+						w.WriteHeader(http.StatusOK)
+
+						conn, br, err := w.(http.Hijacker).Hijack()
+						Ω(err).ShouldNot(HaveOccurred())
+
+						defer conn.Close()
+
+						line, err := br.ReadString('\n')
+						Ω(err).ShouldNot(HaveOccurred())
+
+						fmt.Fprintf(conn, "echo: %s", line)
+					},
+				),
+			)
+		})
+
+		It("returns a connection to the process", func() {
+			conn, err := client.Hijack(build.Guid, map[string]string{"path": "bash"})
+			Ω(err).ShouldNot(HaveOccurred())
+
+			defer conn.Close()
+
+			_, err = fmt.Fprintf(conn, "hello\n")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			line, err := bufio.NewReader(conn).ReadString('\n')
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(line).Should(Equal("echo: hello\n"))
+		})
+	})
+
+	Describe("Abort", func() {
+		var build builds.Build
+
+		BeforeEach(func() {
+			var err error
+			build, err = client.CreateBuild(someBuild)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			trigger(build.Guid, TurbineBuilds.Build{
+				AbortURL: turbineServer.URL() + "/abort",
+			})
+		})
+
+		It("aborts the build in turbine", func() {
+			turbineServer.AppendHandlers(
+				ghttp.CombineHandlers(
+					ghttp.VerifyRequest("POST", "/abort"),
+					ghttp.RespondWith(200, ""),
+				),
+			)
+
+			err := client.Abort(build.Guid, "took too long")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(turbineServer.ReceivedRequests()).Should(HaveLen(2))
+
+			result, err := client.GetResult(build.Guid)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(result.Status).Should(Equal("aborted"))
+		})
+	})
+
+	Describe("GetResult", func() {
+		var build builds.Build
+
+		BeforeEach(func() {
+			var err error
+			build, err = client.CreateBuild(someBuild)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			req, err := http.NewRequest(
+				"PUT",
+				server.URL+"/builds/"+build.Guid+"/result",
+				bytes.NewBufferString(`{"status":"succeeded"}`),
+			)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			_, err = http.DefaultClient.Do(req)
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("returns the build's result", func() {
+			result, err := client.GetResult(build.Guid)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(result.Status).Should(Equal("succeeded"))
+		})
+	})
+})
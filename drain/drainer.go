@@ -0,0 +1,83 @@
+package drain
+
+import (
+	"sync"
+	"time"
+)
+
+// Drainer coordinates a graceful shutdown. Once started, components should
+// stop accepting new work; Drain then gives them until the timeout to finish
+// what they have in flight.
+type Drainer struct {
+	timeout time.Duration
+
+	draining  chan struct{}
+	startOnce *sync.Once
+
+	hooks      []func(deadline time.Time)
+	hooksMutex *sync.Mutex
+}
+
+func NewDrainer(timeout time.Duration) *Drainer {
+	return &Drainer{
+		timeout: timeout,
+
+		draining:  make(chan struct{}),
+		startOnce: new(sync.Once),
+
+		hooksMutex: new(sync.Mutex),
+	}
+}
+
+// OnDrain registers a function to be called when draining. It should return
+// by the given deadline.
+func (drainer *Drainer) OnDrain(hook func(deadline time.Time)) {
+	drainer.hooksMutex.Lock()
+	drainer.hooks = append(drainer.hooks, hook)
+	drainer.hooksMutex.Unlock()
+}
+
+// Start marks the drainer as draining. It is safe to call more than once.
+func (drainer *Drainer) Start() {
+	drainer.startOnce.Do(func() {
+		close(drainer.draining)
+	})
+}
+
+// Draining returns a channel that is closed once draining has started.
+func (drainer *Drainer) Draining() <-chan struct{} {
+	return drainer.draining
+}
+
+func (drainer *Drainer) IsDraining() bool {
+	select {
+	case <-drainer.draining:
+		return true
+	default:
+		return false
+	}
+}
+
+// Drain starts draining and runs every hook, returning once they have all
+// returned.
+func (drainer *Drainer) Drain() {
+	drainer.Start()
+
+	deadline := time.Now().Add(drainer.timeout)
+
+	drainer.hooksMutex.Lock()
+	hooks := drainer.hooks
+	drainer.hooksMutex.Unlock()
+
+	wg := new(sync.WaitGroup)
+	for _, hook := range hooks {
+		wg.Add(1)
+
+		go func(hook func(time.Time)) {
+			defer wg.Done()
+			hook(deadline)
+		}(hook)
+	}
+
+	wg.Wait()
+}
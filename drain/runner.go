@@ -0,0 +1,42 @@
+package drain
+
+import (
+	"os"
+
+	"github.com/tedsuo/ifrit"
+)
+
+type runner struct {
+	server  ifrit.Runner
+	drainer *Drainer
+}
+
+// NewRunner runs the server until it is signalled or the drainer starts
+// draining, at which point it drains before signalling the server to stop.
+func NewRunner(server ifrit.Runner, drainer *Drainer) ifrit.Runner {
+	return &runner{
+		server:  server,
+		drainer: drainer,
+	}
+}
+
+func (runner *runner) Run(signals <-chan os.Signal, ready chan<- struct{}) error {
+	process := ifrit.Envoke(runner.server)
+
+	close(ready)
+
+	var signal os.Signal = os.Interrupt
+
+	select {
+	case signal = <-signals:
+	case <-runner.drainer.Draining():
+	case err := <-process.Wait():
+		return err
+	}
+
+	runner.drainer.Drain()
+
+	process.Signal(signal)
+
+	return <-process.Wait()
+}
@@ -0,0 +1,102 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/concourse/glider/api/builds"
+)
+
+type Type string
+
+const (
+	Created       Type = "created"
+	BitsUploaded  Type = "bits_uploaded"
+	Triggered     Type = "triggered"
+	StatusChanged Type = "status_changed"
+	Aborted       Type = "aborted"
+	Reaped        Type = "reaped"
+)
+
+type Event struct {
+	Type  Type         `json:"type"`
+	Time  time.Time    `json:"time"`
+	Build builds.Build `json:"build"`
+}
+
+// subscribers that fall this far behind are disconnected
+const subscriberBuffer = 128
+
+// Hub fans out build events to every subscriber.
+type Hub struct {
+	subscribers      map[chan Event]struct{}
+	subscribersMutex *sync.Mutex
+
+	closed bool
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subscribers:      make(map[chan Event]struct{}),
+		subscribersMutex: new(sync.Mutex),
+	}
+}
+
+// Subscribe returns a channel of every event published from now on. The
+// channel is closed when the subscriber is unsubscribed, falls too far
+// behind, or the hub is closed.
+func (hub *Hub) Subscribe() (<-chan Event, func()) {
+	subscriber := make(chan Event, subscriberBuffer)
+
+	hub.subscribersMutex.Lock()
+	if hub.closed {
+		close(subscriber)
+	} else {
+		hub.subscribers[subscriber] = struct{}{}
+	}
+	hub.subscribersMutex.Unlock()
+
+	return subscriber, func() {
+		hub.subscribersMutex.Lock()
+		hub.unsubscribe(subscriber)
+		hub.subscribersMutex.Unlock()
+	}
+}
+
+func (hub *Hub) Publish(eventType Type, build builds.Build) {
+	event := Event{
+		Type:  eventType,
+		Time:  time.Now(),
+		Build: build,
+	}
+
+	hub.subscribersMutex.Lock()
+	defer hub.subscribersMutex.Unlock()
+
+	for subscriber := range hub.subscribers {
+		select {
+		case subscriber <- event:
+		default:
+			hub.unsubscribe(subscriber)
+		}
+	}
+}
+
+// Close disconnects every subscriber and refuses new ones.
+func (hub *Hub) Close() {
+	hub.subscribersMutex.Lock()
+	defer hub.subscribersMutex.Unlock()
+
+	for subscriber := range hub.subscribers {
+		hub.unsubscribe(subscriber)
+	}
+
+	hub.closed = true
+}
+
+func (hub *Hub) unsubscribe(subscriber chan Event) {
+	if _, found := hub.subscribers[subscriber]; found {
+		delete(hub.subscribers, subscriber)
+		close(subscriber)
+	}
+}
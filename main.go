@@ -2,11 +2,24 @@ package main
 
 import (
 	"flag"
+	"net/http"
 	"os"
+	"strings"
+	"time"
 
 	"github.com/concourse/glider/api"
+	"github.com/concourse/glider/auth"
+	"github.com/concourse/glider/drain"
+	"github.com/concourse/glider/metrics"
+	"github.com/concourse/glider/policy"
+	"github.com/concourse/glider/quota"
+	"github.com/concourse/glider/ratelimit"
+	"github.com/concourse/glider/secrets"
+	"github.com/concourse/glider/store"
+	"github.com/concourse/glider/webhooks"
 	"github.com/pivotal-golang/lager"
 	"github.com/tedsuo/ifrit"
+	"github.com/tedsuo/ifrit/grouper"
 	"github.com/tedsuo/ifrit/http_server"
 	"github.com/tedsuo/ifrit/sigmon"
 )
@@ -29,22 +42,263 @@ var turbineURL = flag.String(
 	"address denoting the turbine service",
 )
 
+var policyFile = flag.String(
+	"policyFile",
+	"",
+	"path to a JSON file restricting the builds that may be run",
+)
+
+var quotasFile = flag.String(
+	"quotasFile",
+	"",
+	"path to a JSON file limiting the builds, bits and logs of each team and user",
+)
+
+var usersFile = flag.String(
+	"usersFile",
+	"",
+	"path to a JSON file listing users allowed to access the API; if omitted, access is unauthenticated",
+)
+
+var allowAnonymousAdmin = flag.Bool(
+	"allowAnonymousAdmin",
+	false,
+	"allow anonymous callers to use admin routes, such as draining, when no -usersFile is given",
+)
+
+var rateLimitsFile = flag.String(
+	"rateLimitsFile",
+	"",
+	"path to a JSON file of per-route rate limits for each client, keyed by route name, or by FailedAuthentication for failed authentications per IP",
+)
+
+var metricsListenAddr = flag.String(
+	"metricsListenAddr",
+	"",
+	"listening address for the /metrics endpoint; if omitted, it is served alongside the API",
+)
+
+var storeDir = flag.String(
+	"storeDir",
+	"",
+	"directory in which to persist builds; if omitted, builds are kept in memory",
+)
+
+var secretKeysFile = flag.String(
+	"secretKeysFile",
+	"",
+	"path to a JSON list of AES keys with which to encrypt secret params at rest; the first encrypts, the rest only decrypt",
+)
+
+var drainTimeout = flag.Duration(
+	"drainTimeout",
+	5*time.Minute,
+	"how long to wait for in-flight uploads and running builds when shutting down",
+)
+
+var webhookURLs = flag.String(
+	"webhookURLs",
+	"",
+	"comma-separated URLs to notify of every build's lifecycle events",
+)
+
+var webhookSecret = flag.String(
+	"webhookSecret",
+	"",
+	"secret with which to sign webhook payloads",
+)
+
+var webhookAttempts = flag.Int(
+	"webhookAttempts",
+	5,
+	"number of times to attempt each webhook delivery",
+)
+
+var webhookBackoff = flag.Duration(
+	"webhookBackoff",
+	time.Second,
+	"time to wait before retrying a failed webhook delivery; doubles with each attempt",
+)
+
+var metricLabels = flag.String(
+	"metricLabels",
+	"",
+	"build labels by which to break down build metrics, with the values to count separately, e.g. purpose=smoke|release,env=prod; other values are counted as 'other'",
+)
+
+var recordHijacks = flag.Bool(
+	"recordHijacks",
+	false,
+	"record a transcript of every hijack session, in asciicast format",
+)
+
+var maxRecordingSize = flag.Int(
+	"maxRecordingSize",
+	10*1024*1024,
+	"maximum size in bytes of each hijack recording; later input and output is not recorded; 0 means no limit",
+)
+
+var maxHijacksPerBuild = flag.Int(
+	"maxHijacksPerBuild",
+	0,
+	"maximum number of concurrent hijack sessions per build; 0 means no limit",
+)
+
+var hijackIdleTimeout = flag.Duration(
+	"hijackIdleTimeout",
+	30*time.Minute,
+	"terminate hijack sessions after this long without input or output; 0 means never",
+)
+
+var hijackTimeout = flag.Duration(
+	"hijackTimeout",
+	0,
+	"terminate hijack sessions after this long regardless of activity; 0 means never",
+)
+
+var keepaliveInterval = flag.Duration(
+	"keepaliveInterval",
+	30*time.Second,
+	"how often to ping log streaming websockets; viewers that miss two pings are disconnected",
+)
+
 func main() {
 	flag.Parse()
 
 	logger := lager.NewLogger("glider")
 	logger.RegisterSink(lager.NewWriterSink(os.Stdout, lager.DEBUG))
 
-	handler, err := api.New(logger.Session("api"), *peerAddr, *turbineURL)
+	var buildPolicy policy.Policy
+	if *policyFile != "" {
+		var err error
+
+		buildPolicy, err = policy.Load(*policyFile)
+		if err != nil {
+			logger.Fatal("failed-to-load-policy", err)
+		}
+	}
+
+	var quotas quota.Quotas
+	if *quotasFile != "" {
+		var err error
+
+		quotas, err = quota.Load(*quotasFile)
+		if err != nil {
+			logger.Fatal("failed-to-load-quotas", err)
+		}
+	}
+
+	var authenticator auth.Authenticator = auth.NoopAuthenticator{Admin: *allowAnonymousAdmin}
+	if *usersFile != "" {
+		var err error
+
+		authenticator, err = auth.LoadUsers(*usersFile)
+		if err != nil {
+			logger.Fatal("failed-to-load-users", err)
+		}
+	}
+
+	var rateLimits ratelimit.Limits
+	if *rateLimitsFile != "" {
+		var err error
+
+		rateLimits, err = ratelimit.Load(*rateLimitsFile)
+		if err != nil {
+			logger.Fatal("failed-to-load-rate-limits", err)
+		}
+	}
+
+	buildStore := store.NewMemoryStore()
+	if *storeDir != "" {
+		var err error
+
+		buildStore, err = store.NewDirStore(*storeDir)
+		if err != nil {
+			logger.Fatal("failed-to-initialize-store", err)
+		}
+	}
+
+	var keyring *secrets.Keyring
+	if *secretKeysFile != "" {
+		var err error
+
+		keyring, err = secrets.Load(*secretKeysFile)
+		if err != nil {
+			logger.Fatal("failed-to-load-secret-keys", err)
+		}
+	}
+
+	drainer := drain.NewDrainer(*drainTimeout)
+
+	var notifyURLs []string
+	if *webhookURLs != "" {
+		notifyURLs = strings.Split(*webhookURLs, ",")
+	}
+
+	notifier := webhooks.NewNotifier(
+		logger.Session("webhooks"),
+		notifyURLs,
+		*webhookSecret,
+		*webhookAttempts,
+		*webhookBackoff,
+	)
+
+	metricLabelValues, err := metrics.ParseLabelValues(*metricLabels)
+	if err != nil {
+		logger.Fatal("failed-to-parse-metric-labels", err)
+	}
+
+	handler, err := api.New(api.Config{
+		Logger: logger.Session("api"),
+
+		PeerAddr:   *peerAddr,
+		TurbineURL: *turbineURL,
+
+		Policy:        buildPolicy,
+		Quotas:        quotas,
+		Authenticator: authenticator,
+		RateLimits:    rateLimits,
+		Store:         buildStore,
+
+		Keyring: keyring,
+
+		Drainer:  drainer,
+		Notifier: notifier,
+
+		MetricLabels: metricLabelValues,
+
+		RecordHijacks: *recordHijacks,
+
+		MaxRecordingSize:   *maxRecordingSize,
+		MaxHijacksPerBuild: *maxHijacksPerBuild,
+
+		HijackIdleTimeout: *hijackIdleTimeout,
+		HijackTimeout:     *hijackTimeout,
+		KeepaliveInterval: *keepaliveInterval,
+	})
 	if err != nil {
 		logger.Fatal("failed-to-initialize-handler", err)
 	}
 
-	server := http_server.New(*listenAddr, handler)
-	running := ifrit.Envoke(sigmon.New(server))
+	var server ifrit.Runner
+	if *metricsListenAddr == "" {
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler())
+		mux.Handle("/", handler)
+
+		server = http_server.New(*listenAddr, mux)
+	} else {
+		server = grouper.RunGroup{
+			"api":     http_server.New(*listenAddr, handler),
+			"metrics": http_server.New(*metricsListenAddr, metrics.Handler()),
+		}
+	}
+
+	running := ifrit.Envoke(sigmon.New(drain.NewRunner(server, drainer)))
 
 	logger.Info("listening", lager.Data{
-		"api": *listenAddr,
+		"api":     *listenAddr,
+		"metrics": *metricsListenAddr,
 	})
 
 	err = <-running.Wait()
@@ -0,0 +1,86 @@
+package metrics
+
+var (
+	durationBuckets = []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 10, 30, 60, 300}
+	sizeBuckets     = []float64{1 << 10, 1 << 14, 1 << 17, 1 << 20, 1 << 23, 1 << 26, 1 << 29}
+)
+
+var BuildsCreated = NewCounter(
+	"glider_builds_created_total",
+	"Number of builds created.",
+)
+
+var BuildStatuses = NewCounter(
+	"glider_build_statuses_total",
+	"Number of builds that have reached each status, as reported by turbine.",
+	"status",
+)
+
+var LabelledBuildsCreated = NewCounter(
+	"glider_labelled_builds_created_total",
+	"Number of builds created with each value of the labels configured with -metricLabels; unlisted values are counted as other.",
+	"label",
+	"value",
+)
+
+var LabelledBuildStatuses = NewCounter(
+	"glider_labelled_build_statuses_total",
+	"Number of builds with each value of the labels configured with -metricLabels that have reached each status; unlisted values are counted as other.",
+	"label",
+	"value",
+	"status",
+)
+
+var UploadBytes = NewHistogram(
+	"glider_upload_bytes",
+	"Size of the bits uploaded for each build.",
+	sizeBuckets,
+)
+
+var UploadDuration = NewHistogram(
+	"glider_upload_duration_seconds",
+	"Time taken to trigger a build and stream its bits to turbine.",
+	durationBuckets,
+)
+
+var TurbineRequestDuration = NewHistogram(
+	"glider_turbine_request_duration_seconds",
+	"Latency of requests made to turbine.",
+	durationBuckets,
+	"request",
+)
+
+var TurbineErrors = NewCounter(
+	"glider_turbine_errors_total",
+	"Number of requests to turbine that failed or returned an unexpected status.",
+	"request",
+)
+
+var HijackSessions = NewGauge(
+	"glider_hijack_sessions",
+	"Number of hijack sessions currently attached.",
+)
+
+var LogSinks = NewGauge(
+	"glider_log_sinks",
+	"Number of clients currently streaming build logs.",
+)
+
+var QuotaRejections = NewCounter(
+	"glider_quota_rejections_total",
+	"Number of requests refused for exceeding a team or user quota.",
+	"quota",
+)
+
+var RateLimited = NewCounter(
+	"glider_rate_limited_total",
+	"Number of requests refused for exceeding a route's rate limit.",
+	"route",
+)
+
+var ClosedConnections = NewCounter(
+	"glider_closed_connections_total",
+	"Number of hijack and log connections closed by glider for being idle, running too long, or failing keepalives.",
+	"connection",
+	"reason",
+)
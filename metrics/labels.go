@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"fmt"
+	"strings"
+)
+
+// OtherLabelValue is counted in place of build label values that are not
+// listed, so that the number of series stays bounded.
+const OtherLabelValue = "other"
+
+// LabelValues lists, for each key of the build labels to break metrics down
+// by, the values to count separately.
+type LabelValues map[string][]string
+
+// ParseLabelValues parses a comma-separated list of key=value|value|...
+// entries, e.g. purpose=smoke|release,env=prod|staging. Every key must list
+// at least one value.
+func ParseLabelValues(spec string) (LabelValues, error) {
+	labelValues := LabelValues{}
+
+	if spec == "" {
+		return labelValues, nil
+	}
+
+	for _, entry := range strings.Split(spec, ",") {
+		pair := strings.SplitN(entry, "=", 2)
+		if len(pair) != 2 || pair[0] == "" || pair[1] == "" {
+			return nil, fmt.Errorf("malformed metric label: %s; expected key=value|value", entry)
+		}
+
+		for _, value := range strings.Split(pair[1], "|") {
+			if value == "" {
+				return nil, fmt.Errorf("malformed metric label: %s; values may not be empty", entry)
+			}
+
+			labelValues[pair[0]] = append(labelValues[pair[0]], value)
+		}
+	}
+
+	return labelValues, nil
+}
+
+// Value returns the value to count for the label, which is OtherLabelValue
+// unless the value is listed.
+func (labelValues LabelValues) Value(key string, value string) string {
+	for _, listed := range labelValues[key] {
+		if listed == value {
+			return value
+		}
+	}
+
+	return OtherLabelValue
+}
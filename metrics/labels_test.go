@@ -0,0 +1,47 @@
+package metrics_test
+
+import (
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/concourse/glider/metrics"
+)
+
+var _ = Describe("LabelValues", func() {
+	Describe("ParseLabelValues", func() {
+		It("parses the values listed for each key", func() {
+			labelValues, err := ParseLabelValues("purpose=smoke|release,env=prod")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(labelValues).Should(Equal(LabelValues{
+				"purpose": {"smoke", "release"},
+				"env":     {"prod"},
+			}))
+		})
+
+		It("parses nothing from nothing", func() {
+			labelValues, err := ParseLabelValues("")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(labelValues).Should(BeEmpty())
+		})
+
+		It("requires every key to list values", func() {
+			_, err := ParseLabelValues("purpose")
+			Ω(err).Should(HaveOccurred())
+
+			_, err = ParseLabelValues("purpose=smoke||release")
+			Ω(err).Should(HaveOccurred())
+		})
+	})
+
+	Describe("Value", func() {
+		labelValues := LabelValues{"purpose": {"smoke"}}
+
+		It("returns listed values", func() {
+			Ω(labelValues.Value("purpose", "smoke")).Should(Equal("smoke"))
+		})
+
+		It("returns other for values that are not listed", func() {
+			Ω(labelValues.Value("purpose", "OPS-123")).Should(Equal(OtherLabelValue))
+		})
+	})
+})
@@ -0,0 +1,243 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Registry collects metrics and renders them in the Prometheus text format.
+type Registry struct {
+	metrics      []metric
+	metricsMutex *sync.Mutex
+}
+
+type metric interface {
+	writeTo(io.Writer)
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		metricsMutex: new(sync.Mutex),
+	}
+}
+
+var DefaultRegistry = NewRegistry()
+
+func (registry *Registry) register(metric metric) {
+	registry.metricsMutex.Lock()
+	registry.metrics = append(registry.metrics, metric)
+	registry.metricsMutex.Unlock()
+}
+
+func (registry *Registry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	w.WriteHeader(http.StatusOK)
+
+	registry.metricsMutex.Lock()
+	metrics := registry.metrics
+	registry.metricsMutex.Unlock()
+
+	for _, metric := range metrics {
+		metric.writeTo(w)
+	}
+}
+
+// Handler serves every metric in the default registry.
+func Handler() http.Handler {
+	return DefaultRegistry
+}
+
+type family struct {
+	name       string
+	help       string
+	kind       string
+	labelNames []string
+
+	series      map[string]*series
+	seriesMutex *sync.Mutex
+}
+
+type series struct {
+	labelValues []string
+
+	value float64
+
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+func newFamily(name string, help string, kind string, labelNames []string) *family {
+	return &family{
+		name:       name,
+		help:       help,
+		kind:       kind,
+		labelNames: labelNames,
+
+		series:      make(map[string]*series),
+		seriesMutex: new(sync.Mutex),
+	}
+}
+
+func (family *family) with(labelValues []string, update func(*series)) {
+	if len(labelValues) != len(family.labelNames) {
+		panic(fmt.Sprintf("%s: expected %d label values, got %d", family.name, len(family.labelNames), len(labelValues)))
+	}
+
+	key := strings.Join(labelValues, "\xff")
+
+	family.seriesMutex.Lock()
+	defer family.seriesMutex.Unlock()
+
+	s, found := family.series[key]
+	if !found {
+		s = &series{labelValues: labelValues}
+		family.series[key] = s
+	}
+
+	update(s)
+}
+
+func (family *family) writeTo(w io.Writer) {
+	fmt.Fprintf(w, "# HELP %s %s\n", family.name, family.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", family.name, family.kind)
+
+	family.seriesMutex.Lock()
+	defer family.seriesMutex.Unlock()
+
+	keys := make([]string, 0, len(family.series))
+	for key := range family.series {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		s := family.series[key]
+
+		if family.kind != "histogram" {
+			fmt.Fprintf(w, "%s%s %s\n", family.name, family.labels(s.labelValues, "", ""), formatFloat(s.value))
+			continue
+		}
+
+		for i, bound := range s.buckets {
+			fmt.Fprintf(w, "%s_bucket%s %d\n", family.name, family.labels(s.labelValues, "le", formatFloat(bound)), s.counts[i])
+		}
+
+		fmt.Fprintf(w, "%s_bucket%s %d\n", family.name, family.labels(s.labelValues, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", family.name, family.labels(s.labelValues, "", ""), formatFloat(s.sum))
+		fmt.Fprintf(w, "%s_count%s %d\n", family.name, family.labels(s.labelValues, "", ""), s.count)
+	}
+}
+
+func (family *family) labels(values []string, extraName string, extraValue string) string {
+	pairs := []string{}
+
+	for i, name := range family.labelNames {
+		pairs = append(pairs, name+`="`+escape(values[i])+`"`)
+	}
+
+	if extraName != "" {
+		pairs = append(pairs, extraName+`="`+extraValue+`"`)
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escape(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+type Counter struct {
+	family *family
+}
+
+func NewCounter(name string, help string, labelNames ...string) Counter {
+	counter := Counter{newFamily(name, help, "counter", labelNames)}
+	DefaultRegistry.register(counter.family)
+	return counter
+}
+
+func (counter Counter) Add(delta float64, labelValues ...string) {
+	counter.family.with(labelValues, func(s *series) {
+		s.value += delta
+	})
+}
+
+func (counter Counter) Inc(labelValues ...string) {
+	counter.Add(1, labelValues...)
+}
+
+type Gauge struct {
+	family *family
+}
+
+func NewGauge(name string, help string, labelNames ...string) Gauge {
+	gauge := Gauge{newFamily(name, help, "gauge", labelNames)}
+	DefaultRegistry.register(gauge.family)
+	return gauge
+}
+
+func (gauge Gauge) Add(delta float64, labelValues ...string) {
+	gauge.family.with(labelValues, func(s *series) {
+		s.value += delta
+	})
+}
+
+func (gauge Gauge) Inc(labelValues ...string) {
+	gauge.Add(1, labelValues...)
+}
+
+func (gauge Gauge) Dec(labelValues ...string) {
+	gauge.Add(-1, labelValues...)
+}
+
+type Histogram struct {
+	family  *family
+	buckets []float64
+}
+
+func NewHistogram(name string, help string, buckets []float64, labelNames ...string) Histogram {
+	histogram := Histogram{newFamily(name, help, "histogram", labelNames), buckets}
+	DefaultRegistry.register(histogram.family)
+	return histogram
+}
+
+func (histogram Histogram) Observe(value float64, labelValues ...string) {
+	histogram.family.with(labelValues, func(s *series) {
+		if s.counts == nil {
+			s.buckets = histogram.buckets
+			s.counts = make([]uint64, len(histogram.buckets))
+		}
+
+		for i, bound := range s.buckets {
+			if value <= bound {
+				s.counts[i]++
+			}
+		}
+
+		s.sum += value
+		s.count++
+	})
+}
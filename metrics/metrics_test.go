@@ -0,0 +1,69 @@
+package metrics_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/concourse/glider/metrics"
+)
+
+var _ = Describe("Metrics", func() {
+	scrape := func() string {
+		recorder := httptest.NewRecorder()
+		Handler().ServeHTTP(recorder, &http.Request{})
+		return recorder.Body.String()
+	}
+
+	Describe("counters", func() {
+		It("are exported per set of label values", func() {
+			counter := NewCounter("test_things_total", "Things.", "kind")
+			counter.Inc("a")
+			counter.Add(2, "b")
+			counter.Inc("a")
+
+			Ω(scrape()).Should(ContainSubstring(`# HELP test_things_total Things.
+# TYPE test_things_total counter
+test_things_total{kind="a"} 2
+test_things_total{kind="b"} 2
+`))
+		})
+
+		It("escapes label values", func() {
+			counter := NewCounter("test_escaped_total", "Escaped.", "kind")
+			counter.Inc("a \"quoted\"\nvalue")
+
+			Ω(scrape()).Should(ContainSubstring(`test_escaped_total{kind="a \"quoted\"\nvalue"} 1`))
+		})
+	})
+
+	Describe("gauges", func() {
+		It("go up and down", func() {
+			gauge := NewGauge("test_gauge", "A gauge.")
+			gauge.Inc()
+			gauge.Inc()
+			gauge.Dec()
+
+			Ω(scrape()).Should(ContainSubstring("test_gauge 1\n"))
+		})
+	})
+
+	Describe("histograms", func() {
+		It("export cumulative buckets, a sum, and a count", func() {
+			histogram := NewHistogram("test_seconds", "A histogram.", []float64{1, 5})
+			histogram.Observe(0.5)
+			histogram.Observe(3)
+			histogram.Observe(10)
+
+			Ω(scrape()).Should(ContainSubstring(`# TYPE test_seconds histogram
+test_seconds_bucket{le="1"} 1
+test_seconds_bucket{le="5"} 2
+test_seconds_bucket{le="+Inf"} 3
+test_seconds_sum 13.5
+test_seconds_count 3
+`))
+		})
+	})
+})
@@ -0,0 +1,177 @@
+package policy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/concourse/glider/api/builds"
+	"github.com/concourse/glider/auth"
+)
+
+type Policy struct {
+	// patterns that the build's image must match; '*' matches anything
+	AllowedImages []string `json:"allowed_images,omitempty"`
+
+	// patterns that the build's run path must not match
+	DeniedRunPaths []string `json:"denied_run_paths,omitempty"`
+
+	// maximum combined size of param names and values, in bytes
+	MaxParamsSize int `json:"max_params_size,omitempty"`
+
+	Privileged PrivilegedPolicy `json:"privileged"`
+
+	// patterns that the hosts of builds' own notify urls must match; without
+	// any, builds may not have their own notify urls
+	AllowedNotifyHosts []string `json:"allowed_notify_hosts,omitempty"`
+}
+
+// PrivilegedPolicy controls privileged builds. They are refused unless
+// Allowed is set, and then limited to the listed users and teams, if any.
+type PrivilegedPolicy struct {
+	Allowed bool `json:"allowed"`
+
+	Users []string `json:"users,omitempty"`
+	Teams []string `json:"teams,omitempty"`
+}
+
+type Violation struct {
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+const (
+	RuleAllowedImages  = "allowed_images"
+	RuleDeniedRunPaths = "denied_run_paths"
+	RuleMaxParamsSize  = "max_params_size"
+	RulePrivileged     = "privileged"
+	RuleNotifyHosts    = "allowed_notify_hosts"
+)
+
+func Load(path string) (Policy, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Policy{}, err
+	}
+
+	defer file.Close()
+
+	var policy Policy
+	err = json.NewDecoder(file).Decode(&policy)
+	if err != nil {
+		return Policy{}, err
+	}
+
+	return policy, nil
+}
+
+// Check returns every rule the build violates when run by the given identity.
+func (policy Policy) Check(identity auth.Identity, build builds.Build) []Violation {
+	violations := []Violation{}
+
+	if len(policy.AllowedImages) > 0 && !matchesAny(policy.AllowedImages, build.Config.Image) {
+		violations = append(violations, Violation{
+			Rule:    RuleAllowedImages,
+			Message: fmt.Sprintf("image '%s' is not allowed", build.Config.Image),
+		})
+	}
+
+	if matchesAny(policy.DeniedRunPaths, build.Config.Run.Path) {
+		violations = append(violations, Violation{
+			Rule:    RuleDeniedRunPaths,
+			Message: fmt.Sprintf("run path '%s' is not allowed", build.Config.Run.Path),
+		})
+	}
+
+	if policy.MaxParamsSize > 0 {
+		size := paramsSize(build.Config.Params)
+		if size > policy.MaxParamsSize {
+			violations = append(violations, Violation{
+				Rule:    RuleMaxParamsSize,
+				Message: fmt.Sprintf("params are %d bytes; maximum is %d", size, policy.MaxParamsSize),
+			})
+		}
+	}
+
+	for _, notifyURL := range build.Notify {
+		parsed, err := url.Parse(notifyURL)
+		if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+			// reported as invalid rather than as a violation
+			continue
+		}
+
+		if !matchesAny(policy.AllowedNotifyHosts, parsed.Hostname()) {
+			violations = append(violations, Violation{
+				Rule:    RuleNotifyHosts,
+				Message: fmt.Sprintf("notify host '%s' is not allowed", parsed.Hostname()),
+			})
+		}
+	}
+
+	if build.Privileged {
+		if !policy.Privileged.Allowed {
+			violations = append(violations, Violation{
+				Rule:    RulePrivileged,
+				Message: "privileged builds are disabled",
+			})
+		} else if !policy.Privileged.allows(identity) {
+			violations = append(violations, Violation{
+				Rule:    RulePrivileged,
+				Message: "privileged builds are not allowed for this user",
+			})
+		}
+	}
+
+	return violations
+}
+
+func (privileged PrivilegedPolicy) allows(identity auth.Identity) bool {
+	if len(privileged.Users) == 0 && len(privileged.Teams) == 0 {
+		return true
+	}
+
+	for _, user := range privileged.Users {
+		if identity.User != "" && user == identity.User {
+			return true
+		}
+	}
+
+	for _, team := range privileged.Teams {
+		if identity.Team != "" && team == identity.Team {
+			return true
+		}
+	}
+
+	return false
+}
+
+func paramsSize(params map[string]string) int {
+	size := 0
+	for k, v := range params {
+		size += len(k) + len(v)
+	}
+
+	return size
+}
+
+func matchesAny(patterns []string, value string) bool {
+	for _, pattern := range patterns {
+		if match(pattern, value) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func match(pattern string, value string) bool {
+	parts := strings.Split(pattern, "*")
+	for i, part := range parts {
+		parts[i] = regexp.QuoteMeta(part)
+	}
+
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$").MatchString(value)
+}
@@ -0,0 +1,56 @@
+package quota
+
+import (
+	"encoding/json"
+	"os"
+
+	"github.com/concourse/glider/api/builds"
+)
+
+// Wildcard names the limits that apply to any team or user not listed.
+const Wildcard = "*"
+
+// Quotas limit how much each team and user may use glider. Both the limits
+// of the caller and of their team apply.
+type Quotas struct {
+	Teams map[string]builds.QuotaLimits `json:"teams,omitempty"`
+	Users map[string]builds.QuotaLimits `json:"users,omitempty"`
+}
+
+func Load(path string) (Quotas, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Quotas{}, err
+	}
+
+	defer file.Close()
+
+	var quotas Quotas
+	err = json.NewDecoder(file).Decode(&quotas)
+	if err != nil {
+		return Quotas{}, err
+	}
+
+	return quotas, nil
+}
+
+func (quotas Quotas) Team(name string) builds.QuotaLimits {
+	return lookup(quotas.Teams, name)
+}
+
+func (quotas Quotas) User(name string) builds.QuotaLimits {
+	return lookup(quotas.Users, name)
+}
+
+func lookup(limits map[string]builds.QuotaLimits, name string) builds.QuotaLimits {
+	// anonymous callers are not subject to quotas
+	if name == "" {
+		return builds.QuotaLimits{}
+	}
+
+	if named, found := limits[name]; found {
+		return named
+	}
+
+	return limits[Wildcard]
+}
@@ -0,0 +1,281 @@
+// Package ratelimit throttles API requests with a token bucket per client
+// and route.
+package ratelimit
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/concourse/glider/api/builds"
+	"github.com/concourse/glider/auth"
+	"github.com/concourse/glider/metrics"
+	"github.com/concourse/glider/routes"
+)
+
+// how often to forget clients whose buckets have refilled
+const sweepInterval = time.Minute
+
+// FailedAuthentication keys the limit on failed authentications, which is
+// applied by IP to every authenticated route, in place of a route name.
+const FailedAuthentication = "FailedAuthentication"
+
+// Limit allows Rate requests per second on average, in bursts of up to Burst.
+type Limit struct {
+	Rate  float64 `json:"rate"`
+	Burst int     `json:"burst"`
+}
+
+// Limits are keyed by route name, or by FailedAuthentication. Routes without a
+// limit are not throttled.
+type Limits map[string]Limit
+
+// Load reads limits from a JSON file, checking that every route exists.
+func Load(path string) (Limits, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	var limits Limits
+	err = json.NewDecoder(file).Decode(&limits)
+	if err != nil {
+		return nil, err
+	}
+
+	known := map[string]bool{FailedAuthentication: true}
+	for _, route := range routes.Routes {
+		known[route.Name] = true
+	}
+
+	for name, limit := range limits {
+		if !known[name] {
+			return nil, fmt.Errorf("unknown route: %s", name)
+		}
+
+		if limit.Rate <= 0 {
+			return nil, fmt.Errorf("rate for %s must be positive", name)
+		}
+	}
+
+	return limits, nil
+}
+
+// Limiter holds a token bucket for each client. It is safe for concurrent
+// use.
+type Limiter struct {
+	limit Limit
+
+	buckets   map[string]*bucket
+	lastSwept time.Time
+	mutex     *sync.Mutex
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+func NewLimiter(limit Limit) *Limiter {
+	if limit.Burst < 1 {
+		limit.Burst = 1
+	}
+
+	return &Limiter{
+		limit: limit,
+
+		buckets:   make(map[string]*bucket),
+		lastSwept: time.Now(),
+		mutex:     new(sync.Mutex),
+	}
+}
+
+// Allow takes a token from the client's bucket. If there are none left, it
+// returns how long until there will be.
+func (limiter *Limiter) Allow(client string) (bool, time.Duration) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	now := time.Now()
+
+	if now.Sub(limiter.lastSwept) > sweepInterval {
+		limiter.sweep(now)
+	}
+
+	b, found := limiter.buckets[client]
+	if !found {
+		b = &bucket{tokens: float64(limiter.limit.Burst)}
+		limiter.buckets[client] = b
+	} else {
+		b.tokens = limiter.refill(b, now)
+	}
+
+	b.updatedAt = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / limiter.limit.Rate * float64(time.Second))
+		return false, wait
+	}
+
+	b.tokens--
+
+	return true, 0
+}
+
+// Exhausted returns true if the client's bucket is empty, and how long until
+// it will not be, without taking a token.
+func (limiter *Limiter) Exhausted(client string) (bool, time.Duration) {
+	limiter.mutex.Lock()
+	defer limiter.mutex.Unlock()
+
+	b, found := limiter.buckets[client]
+	if !found {
+		return false, 0
+	}
+
+	tokens := limiter.refill(b, time.Now())
+	if tokens < 1 {
+		return true, time.Duration((1 - tokens) / limiter.limit.Rate * float64(time.Second))
+	}
+
+	return false, 0
+}
+
+func (limiter *Limiter) refill(b *bucket, now time.Time) float64 {
+	elapsed := now.Sub(b.updatedAt).Seconds()
+	return math.Min(float64(limiter.limit.Burst), b.tokens+elapsed*limiter.limit.Rate)
+}
+
+// sweep forgets clients whose buckets have refilled, as they are no
+// different from clients that have never been seen.
+func (limiter *Limiter) sweep(now time.Time) {
+	for client, b := range limiter.buckets {
+		if limiter.refill(b, now) >= float64(limiter.limit.Burst) {
+			delete(limiter.buckets, client)
+		}
+	}
+
+	limiter.lastSwept = now
+}
+
+type limitHandler struct {
+	route   string
+	handler http.Handler
+	limiter *Limiter
+}
+
+// Handler refuses requests to the route once the client has run out of
+// tokens. Clients are identified by user, or by IP if anonymous, so it must
+// be wrapped by auth.Handler.
+func Handler(route string, handler http.Handler, limiter *Limiter) http.Handler {
+	return limitHandler{
+		route:   route,
+		handler: handler,
+		limiter: limiter,
+	}
+}
+
+func (h limitHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	allowed, wait := h.limiter.Allow(client(r))
+	if !allowed {
+		metrics.RateLimited.Inc(h.route)
+		writeRateLimited(w, wait)
+		return
+	}
+
+	h.handler.ServeHTTP(w, r)
+}
+
+type failuresHandler struct {
+	route   string
+	handler http.Handler
+	limiter *Limiter
+}
+
+// FailuresHandler refuses requests to the route from IPs that have run out
+// of tokens for failed authentications, whether or not they would now
+// authenticate, so that guessing credentials is throttled. It must wrap
+// auth.Handler, whose authenticator must be wrapped by Authenticator with the
+// same limiter.
+func FailuresHandler(route string, handler http.Handler, limiter *Limiter) http.Handler {
+	return failuresHandler{
+		route:   route,
+		handler: handler,
+		limiter: limiter,
+	}
+}
+
+func (h failuresHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	exhausted, wait := h.limiter.Exhausted(clientIP(r))
+	if exhausted {
+		metrics.RateLimited.Inc(h.route)
+		writeRateLimited(w, wait)
+		return
+	}
+
+	h.handler.ServeHTTP(w, r)
+}
+
+type failuresAuthenticator struct {
+	authenticator auth.Authenticator
+	limiter       *Limiter
+}
+
+// Authenticator takes a token from the client IP's bucket whenever the
+// authenticator fails to authenticate a request.
+func Authenticator(authenticator auth.Authenticator, limiter *Limiter) auth.Authenticator {
+	return failuresAuthenticator{
+		authenticator: authenticator,
+		limiter:       limiter,
+	}
+}
+
+func (authenticator failuresAuthenticator) Authenticate(r *http.Request) (auth.Identity, bool) {
+	identity, ok := authenticator.authenticator.Authenticate(r)
+	if !ok {
+		authenticator.limiter.Allow(clientIP(r))
+	}
+
+	return identity, ok
+}
+
+func writeRateLimited(w http.ResponseWriter, wait time.Duration) {
+	// round up, so that retrying on time succeeds
+	seconds := int((wait + time.Second - 1) / time.Second)
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusTooManyRequests)
+
+	json.NewEncoder(w).Encode(builds.ErrorResponse{
+		Error: builds.Error{
+			Code:    builds.ErrorRateLimited,
+			Message: "too many requests; retry after " + strconv.Itoa(seconds) + "s",
+		},
+	})
+}
+
+func client(r *http.Request) string {
+	if user := auth.IdentityFrom(r).User; user != "" {
+		return "user:" + user
+	}
+
+	return clientIP(r)
+}
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	return "ip:" + host
+}
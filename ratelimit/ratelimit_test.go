@@ -0,0 +1,199 @@
+package ratelimit_test
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"time"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	"github.com/concourse/glider/api/builds"
+	"github.com/concourse/glider/auth"
+	. "github.com/concourse/glider/ratelimit"
+)
+
+var _ = Describe("Limiter", func() {
+	var limiter *Limiter
+
+	BeforeEach(func() {
+		limiter = NewLimiter(Limit{Rate: 10, Burst: 2})
+	})
+
+	It("allows a burst, then makes clients wait for the bucket to refill", func() {
+		allowed, _ := limiter.Allow("alice")
+		Ω(allowed).Should(BeTrue())
+
+		allowed, _ = limiter.Allow("alice")
+		Ω(allowed).Should(BeTrue())
+
+		allowed, wait := limiter.Allow("alice")
+		Ω(allowed).Should(BeFalse())
+		Ω(wait).Should(BeNumerically("~", 100*time.Millisecond, 10*time.Millisecond))
+
+		time.Sleep(wait)
+
+		allowed, _ = limiter.Allow("alice")
+		Ω(allowed).Should(BeTrue())
+	})
+
+	It("keeps a bucket for each client", func() {
+		limiter.Allow("alice")
+		limiter.Allow("alice")
+
+		allowed, _ := limiter.Allow("alice")
+		Ω(allowed).Should(BeFalse())
+
+		allowed, _ = limiter.Allow("bob")
+		Ω(allowed).Should(BeTrue())
+	})
+
+	Context("without a burst", func() {
+		BeforeEach(func() {
+			limiter = NewLimiter(Limit{Rate: 1})
+		})
+
+		It("allows one request at a time", func() {
+			allowed, _ := limiter.Allow("alice")
+			Ω(allowed).Should(BeTrue())
+
+			allowed, _ = limiter.Allow("alice")
+			Ω(allowed).Should(BeFalse())
+		})
+	})
+})
+
+var _ = Describe("Handler", func() {
+	var handler http.Handler
+
+	request := func(remoteAddr string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+
+		req, err := http.NewRequest("POST", "/builds", nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		req.RemoteAddr = remoteAddr
+
+		handler.ServeHTTP(recorder, req)
+
+		return recorder
+	}
+
+	BeforeEach(func() {
+		handler = Handler("CreateBuild", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusCreated)
+		}), NewLimiter(Limit{Rate: 0.5, Burst: 1}))
+	})
+
+	It("refuses requests beyond the limit with 429 and a Retry-After", func() {
+		Ω(request("1.2.3.4:1000").Code).Should(Equal(http.StatusCreated))
+
+		recorder := request("1.2.3.4:1001")
+		Ω(recorder.Code).Should(Equal(http.StatusTooManyRequests))
+		Ω(recorder.Header().Get("Retry-After")).Should(Equal("2"))
+
+		var errResponse builds.ErrorResponse
+		err := json.NewDecoder(recorder.Body).Decode(&errResponse)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(errResponse.Error.Code).Should(Equal(builds.ErrorRateLimited))
+	})
+
+	It("limits anonymous clients by IP", func() {
+		Ω(request("1.2.3.4:1000").Code).Should(Equal(http.StatusCreated))
+		Ω(request("5.6.7.8:1000").Code).Should(Equal(http.StatusCreated))
+	})
+})
+
+var _ = Describe("FailuresHandler", func() {
+	var handler http.Handler
+
+	request := func(remoteAddr string, password string) int {
+		recorder := httptest.NewRecorder()
+
+		req, err := http.NewRequest("GET", "/builds", nil)
+		Ω(err).ShouldNot(HaveOccurred())
+		req.RemoteAddr = remoteAddr
+		req.SetBasicAuth("alice", password)
+
+		handler.ServeHTTP(recorder, req)
+
+		return recorder.Code
+	}
+
+	BeforeEach(func() {
+		limiter := NewLimiter(Limit{Rate: 0.5, Burst: 1})
+
+		authenticator := Authenticator(auth.NewBasicAuthenticator([]auth.User{
+			{Name: "alice", Password: "pass"},
+		}), limiter)
+
+		handler = FailuresHandler("GetBuilds", auth.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusOK)
+		}), authenticator), limiter)
+	})
+
+	It("does not count successful authentications", func() {
+		Ω(request("1.2.3.4:1000", "pass")).Should(Equal(http.StatusOK))
+		Ω(request("1.2.3.4:1001", "pass")).Should(Equal(http.StatusOK))
+	})
+
+	It("refuses the IP once it has failed to authenticate too often", func() {
+		Ω(request("1.2.3.4:1000", "wrong")).Should(Equal(http.StatusUnauthorized))
+		Ω(request("1.2.3.4:1001", "pass")).Should(Equal(http.StatusTooManyRequests))
+		Ω(request("5.6.7.8:1000", "pass")).Should(Equal(http.StatusOK))
+	})
+})
+
+var _ = Describe("Load", func() {
+	var path string
+
+	write := func(contents string) {
+		file, err := ioutil.TempFile("", "rate-limits")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		_, err = file.WriteString(contents)
+		Ω(err).ShouldNot(HaveOccurred())
+
+		file.Close()
+
+		path = file.Name()
+	}
+
+	AfterEach(func() {
+		os.Remove(path)
+	})
+
+	It("loads limits keyed by route name", func() {
+		write(`{"CreateBuild": {"rate": 0.5, "burst": 10}}`)
+
+		limits, err := Load(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(limits).Should(Equal(Limits{
+			"CreateBuild": {Rate: 0.5, Burst: 10},
+		}))
+	})
+
+	It("accepts a limit on failed authentications", func() {
+		write(`{"FailedAuthentication": {"rate": 0.1, "burst": 5}}`)
+
+		limits, err := Load(path)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(limits).Should(HaveKey(FailedAuthentication))
+	})
+
+	It("rejects unknown routes", func() {
+		write(`{"CreateBiuld": {"rate": 1}}`)
+
+		_, err := Load(path)
+		Ω(err).Should(MatchError("unknown route: CreateBiuld"))
+	})
+
+	It("rejects rates that are not positive", func() {
+		write(`{"CreateBuild": {"rate": 0}}`)
+
+		_, err := Load(path)
+		Ω(err).Should(HaveOccurred())
+	})
+})
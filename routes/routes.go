@@ -3,26 +3,57 @@ package routes
 import "github.com/tedsuo/rata"
 
 const (
-	CreateBuild  = "CreateBuild"
-	GetBuilds    = "GetBuilds"
-	HijackBuild  = "HijackBuild"
-	AbortBuild   = "AbortBuild"
-	UploadBits   = "UploadBits"
-	DownloadBits = "DownloadBits"
-	SetResult    = "SetResult"
-	GetResult    = "GetResult"
-	LogInput     = "LogInput"
-	LogOutput    = "LogOutput"
+	CreateBuild   = "CreateBuild"
+	ValidateBuild = "ValidateBuild"
+	GetBuilds     = "GetBuilds"
+	AbortBuilds   = "AbortBuilds"
+	DeleteBuilds  = "DeleteBuilds"
+	HijackBuild   = "HijackBuild"
+	AbortBuild    = "AbortBuild"
+	UploadBits    = "UploadBits"
+	DownloadBits  = "DownloadBits"
+	SetResult     = "SetResult"
+	GetResult     = "GetResult"
+	LogInput      = "LogInput"
+	LogOutput     = "LogOutput"
+	Healthz       = "Healthz"
+	Readyz        = "Readyz"
+	Drain         = "Drain"
+
+	HijackBuildWebsocket = "HijackBuildWebsocket"
+	GetHijacks           = "GetHijacks"
+	GetHijackRecording   = "GetHijackRecording"
+	GetActiveHijacks     = "GetActiveHijacks"
+	TerminateHijack      = "TerminateHijack"
+
+	GetDeliveries = "GetDeliveries"
+
+	GetQuotas = "GetQuotas"
+
+	GetTemplates   = "GetTemplates"
+	GetTemplate    = "GetTemplate"
+	SaveTemplate   = "SaveTemplate"
+	DeleteTemplate = "DeleteTemplate"
+
+	StreamEvents = "StreamEvents"
 )
 
 var Routes = rata.Routes{
 	{Path: "/builds", Method: "POST", Name: CreateBuild},
 	{Path: "/builds", Method: "GET", Name: GetBuilds},
+	{Path: "/builds", Method: "DELETE", Name: DeleteBuilds},
+	{Path: "/builds/abort", Method: "POST", Name: AbortBuilds},
+	{Path: "/builds/validate", Method: "POST", Name: ValidateBuild},
 
 	{Path: "/builds/:guid/bits", Method: "POST", Name: UploadBits},
 	{Path: "/builds/:guid/bits", Method: "GET", Name: DownloadBits},
 
 	{Path: "/builds/:guid/hijack", Method: "POST", Name: HijackBuild},
+	{Path: "/builds/:guid/hijack", Method: "GET", Name: HijackBuildWebsocket},
+	{Path: "/builds/:guid/hijacks", Method: "GET", Name: GetHijacks},
+	{Path: "/builds/:guid/hijacks/:id", Method: "DELETE", Name: TerminateHijack},
+	{Path: "/builds/:guid/hijacks/:id/recording", Method: "GET", Name: GetHijackRecording},
+	{Path: "/hijacks", Method: "GET", Name: GetActiveHijacks},
 	{Path: "/builds/:guid/abort", Method: "POST", Name: AbortBuild},
 
 	{Path: "/builds/:guid/result", Method: "PUT", Name: SetResult},
@@ -30,4 +61,43 @@ var Routes = rata.Routes{
 
 	{Path: "/builds/:guid/log/input", Method: "GET", Name: LogInput},
 	{Path: "/builds/:guid/log/output", Method: "GET", Name: LogOutput},
+
+	{Path: "/builds/:guid/deliveries", Method: "GET", Name: GetDeliveries},
+
+	{Path: "/events", Method: "GET", Name: StreamEvents},
+
+	{Path: "/quotas", Method: "GET", Name: GetQuotas},
+
+	{Path: "/templates", Method: "GET", Name: GetTemplates},
+	{Path: "/templates/:name", Method: "GET", Name: GetTemplate},
+	{Path: "/templates/:name", Method: "PUT", Name: SaveTemplate},
+	{Path: "/templates/:name", Method: "DELETE", Name: DeleteTemplate},
+
+	{Path: "/healthz", Method: "GET", Name: Healthz},
+	{Path: "/readyz", Method: "GET", Name: Readyz},
+
+	{Path: "/admin/drain", Method: "POST", Name: Drain},
+}
+
+// Callbacks are the routes hit by turbine rather than by users; they are
+// not subject to authentication.
+var Callbacks = map[string]bool{
+	DownloadBits: true,
+	SetResult:    true,
+	LogInput:     true,
+}
+
+// Admin routes may only be used by admins.
+var Admin = map[string]bool{
+	Drain: true,
+
+	GetActiveHijacks: true,
+	TerminateHijack:  true,
+}
+
+// Probes are hit by load balancers and supervisors; they are not subject to
+// authentication.
+var Probes = map[string]bool{
+	Healthz: true,
+	Readyz:  true,
 }
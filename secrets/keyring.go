@@ -0,0 +1,153 @@
+// Package secrets encrypts values at rest with AES-GCM, under a keyring that
+// allows keys to be rotated.
+package secrets
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// prefix marks encrypted values, which look like "encrypted:<key id>:<data>"
+const prefix = "encrypted:"
+
+var ErrMalformed = errors.New("malformed encrypted value")
+
+// Key is an AES key of 16, 24 or 32 bytes, base64-encoded in JSON.
+type Key struct {
+	ID  string `json:"id"`
+	Key []byte `json:"key"`
+}
+
+// Keyring encrypts with its first key and decrypts with any of them, so that
+// a new key can be put in front of the old ones and values re-encrypted.
+type Keyring struct {
+	current string
+	aeads   map[string]cipher.AEAD
+}
+
+func NewKeyring(keys []Key) (*Keyring, error) {
+	if len(keys) == 0 {
+		return nil, errors.New("no keys given")
+	}
+
+	keyring := &Keyring{
+		current: keys[0].ID,
+		aeads:   make(map[string]cipher.AEAD, len(keys)),
+	}
+
+	for _, key := range keys {
+		if key.ID == "" || strings.Contains(key.ID, ":") {
+			return nil, fmt.Errorf("invalid key id: '%s'", key.ID)
+		}
+
+		if _, found := keyring.aeads[key.ID]; found {
+			return nil, fmt.Errorf("duplicate key id: %s", key.ID)
+		}
+
+		block, err := aes.NewCipher(key.Key)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %s", key.ID, err)
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("key %s: %s", key.ID, err)
+		}
+
+		keyring.aeads[key.ID] = aead
+	}
+
+	return keyring, nil
+}
+
+// Load reads a JSON list of keys, the first of which is used to encrypt.
+func Load(path string) (*Keyring, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	var keys []Key
+	err = json.NewDecoder(file).Decode(&keys)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewKeyring(keys)
+}
+
+func (keyring *Keyring) Encrypt(plaintext string) (string, error) {
+	aead := keyring.aeads[keyring.current]
+
+	nonce := make([]byte, aead.NonceSize())
+
+	_, err := rand.Read(nonce)
+	if err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+
+	return prefix + keyring.current + ":" + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (keyring *Keyring) Decrypt(value string) (string, error) {
+	id, data, err := parse(value)
+	if err != nil {
+		return "", err
+	}
+
+	aead, found := keyring.aeads[id]
+	if !found {
+		return "", fmt.Errorf("unknown key: %s", id)
+	}
+
+	sealed, err := base64.StdEncoding.DecodeString(data)
+	if err != nil || len(sealed) < aead.NonceSize() {
+		return "", ErrMalformed
+	}
+
+	nonce := sealed[:aead.NonceSize()]
+
+	plaintext, err := aead.Open(nil, nonce, sealed[aead.NonceSize():], nil)
+	if err != nil {
+		return "", err
+	}
+
+	return string(plaintext), nil
+}
+
+// IsCurrent returns true if the value is encrypted with the key that new
+// values are encrypted with.
+func (keyring *Keyring) IsCurrent(value string) bool {
+	id, _, err := parse(value)
+	return err == nil && id == keyring.current
+}
+
+// IsEncrypted returns true if the value looks like it was encrypted by a
+// keyring.
+func IsEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+func parse(value string) (string, string, error) {
+	if !IsEncrypted(value) {
+		return "", "", ErrMalformed
+	}
+
+	segments := strings.SplitN(strings.TrimPrefix(value, prefix), ":", 2)
+	if len(segments) != 2 {
+		return "", "", ErrMalformed
+	}
+
+	return segments[0], segments[1], nil
+}
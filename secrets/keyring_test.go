@@ -0,0 +1,144 @@
+package secrets_test
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	. "github.com/onsi/ginkgo"
+	. "github.com/onsi/gomega"
+
+	. "github.com/concourse/glider/secrets"
+)
+
+var _ = Describe("Keyring", func() {
+	oldKey := Key{ID: "old", Key: bytes.Repeat([]byte{1}, 32)}
+	newKey := Key{ID: "new", Key: bytes.Repeat([]byte{2}, 32)}
+
+	var keyring *Keyring
+
+	BeforeEach(func() {
+		var err error
+		keyring, err = NewKeyring([]Key{oldKey})
+		Ω(err).ShouldNot(HaveOccurred())
+	})
+
+	It("decrypts what it encrypts", func() {
+		encrypted, err := keyring.Encrypt("hunter2")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(encrypted).ShouldNot(ContainSubstring("hunter2"))
+		Ω(IsEncrypted(encrypted)).Should(BeTrue())
+
+		decrypted, err := keyring.Decrypt(encrypted)
+		Ω(err).ShouldNot(HaveOccurred())
+		Ω(decrypted).Should(Equal("hunter2"))
+	})
+
+	It("never encrypts the same value the same way twice", func() {
+		first, err := keyring.Encrypt("hunter2")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		second, err := keyring.Encrypt("hunter2")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		Ω(first).ShouldNot(Equal(second))
+	})
+
+	It("refuses values that have been tampered with", func() {
+		encrypted, err := keyring.Encrypt("hunter2")
+		Ω(err).ShouldNot(HaveOccurred())
+
+		tampered := encrypted[:len(encrypted)-4] + "AAA="
+		Ω(tampered).ShouldNot(Equal(encrypted))
+
+		_, err = keyring.Decrypt(tampered)
+		Ω(err).Should(HaveOccurred())
+	})
+
+	It("refuses values that are not encrypted", func() {
+		_, err := keyring.Decrypt("hunter2")
+		Ω(err).Should(Equal(ErrMalformed))
+	})
+
+	Context("when a new key is put in front of the old one", func() {
+		var encrypted string
+		var rotated *Keyring
+
+		BeforeEach(func() {
+			var err error
+
+			encrypted, err = keyring.Encrypt("hunter2")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			rotated, err = NewKeyring([]Key{newKey, oldKey})
+			Ω(err).ShouldNot(HaveOccurred())
+		})
+
+		It("still decrypts values encrypted with the old key", func() {
+			decrypted, err := rotated.Decrypt(encrypted)
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(decrypted).Should(Equal("hunter2"))
+
+			Ω(rotated.IsCurrent(encrypted)).Should(BeFalse())
+		})
+
+		It("encrypts with the new key", func() {
+			reencrypted, err := rotated.Encrypt("hunter2")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			Ω(rotated.IsCurrent(reencrypted)).Should(BeTrue())
+
+			_, err = keyring.Decrypt(reencrypted)
+			Ω(err).Should(MatchError("unknown key: new"))
+		})
+	})
+
+	Describe("NewKeyring", func() {
+		It("requires a key", func() {
+			_, err := NewKeyring(nil)
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("requires keys of a valid AES size", func() {
+			_, err := NewKeyring([]Key{{ID: "short", Key: []byte("short")}})
+			Ω(err).Should(HaveOccurred())
+		})
+
+		It("requires unique key ids", func() {
+			_, err := NewKeyring([]Key{oldKey, oldKey})
+			Ω(err).Should(MatchError("duplicate key id: old"))
+		})
+	})
+
+	Describe("Load", func() {
+		var path string
+
+		BeforeEach(func() {
+			file, err := ioutil.TempFile("", "keys")
+			Ω(err).ShouldNot(HaveOccurred())
+
+			// a 32 byte key, base64-encoded
+			_, err = file.WriteString(`[{"id": "k1", "key": "` + strings.Repeat("A", 43) + `="}]`)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			file.Close()
+
+			path = file.Name()
+		})
+
+		AfterEach(func() {
+			os.Remove(path)
+		})
+
+		It("loads a keyring from a list of base64-encoded keys", func() {
+			loaded, err := Load(path)
+			Ω(err).ShouldNot(HaveOccurred())
+
+			encrypted, err := loaded.Encrypt("hunter2")
+			Ω(err).ShouldNot(HaveOccurred())
+			Ω(encrypted).Should(MatchRegexp("^encrypted:k1:"))
+		})
+	})
+})
@@ -0,0 +1,245 @@
+package store
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/concourse/glider/api/builds"
+)
+
+type dirStore struct {
+	dir string
+}
+
+// NewDirStore returns a store that keeps each build as a JSON file in
+// dir/builds, its hijack sessions and their recordings in
+// dir/hijacks/<guid>, and build templates in dir/templates.
+func NewDirStore(dir string) (Store, error) {
+	err := os.MkdirAll(filepath.Join(dir, "builds"), 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(filepath.Join(dir, "hijacks"), 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(filepath.Join(dir, "templates"), 0700)
+	if err != nil {
+		return nil, err
+	}
+
+	return &dirStore{dir: dir}, nil
+}
+
+func (store *dirStore) SaveBuild(build Build) error {
+	payload, err := json.Marshal(build)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(store.buildPath(build.Guid), payload)
+}
+
+func (store *dirStore) DeleteBuild(guid string) error {
+	err := os.Remove(store.buildPath(guid))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return os.RemoveAll(store.hijacksPath(guid))
+}
+
+func (store *dirStore) Builds() ([]Build, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(store.dir, "builds"))
+	if err != nil {
+		return nil, err
+	}
+
+	builds := []Build{}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		payload, err := ioutil.ReadFile(filepath.Join(store.dir, "builds", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		var build Build
+		err = json.Unmarshal(payload, &build)
+		if err != nil {
+			return nil, err
+		}
+
+		builds = append(builds, build)
+	}
+
+	return builds, nil
+}
+
+func (store *dirStore) SaveHijack(session builds.HijackSession) error {
+	err := os.MkdirAll(store.hijacksPath(session.Build), 0700)
+	if err != nil {
+		return err
+	}
+
+	payload, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(filepath.Join(store.hijacksPath(session.Build), session.ID+".json"), payload)
+}
+
+func (store *dirStore) Hijacks(guid string) ([]builds.HijackSession, error) {
+	sessions := []builds.HijackSession{}
+
+	entries, err := ioutil.ReadDir(store.hijacksPath(guid))
+	if os.IsNotExist(err) {
+		return sessions, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		payload, err := ioutil.ReadFile(filepath.Join(store.hijacksPath(guid), entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		var session builds.HijackSession
+		err = json.Unmarshal(payload, &session)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	sort.Sort(builds.HijackSessionsByStartedAt(sessions))
+
+	return sessions, nil
+}
+
+func (store *dirStore) SaveRecording(guid string, id string, recording []byte) error {
+	err := os.MkdirAll(store.hijacksPath(guid), 0700)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(filepath.Join(store.hijacksPath(guid), id+".cast"), recording)
+}
+
+func (store *dirStore) Recording(guid string, id string) ([]byte, error) {
+	recording, err := ioutil.ReadFile(filepath.Join(store.hijacksPath(guid), id+".cast"))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+
+	return recording, err
+}
+
+func (store *dirStore) SaveTemplate(template builds.Template) error {
+	payload, err := json.Marshal(template)
+	if err != nil {
+		return err
+	}
+
+	return writeFile(store.templatePath(template.Team, template.Name), payload)
+}
+
+func (store *dirStore) DeleteTemplate(team string, name string) error {
+	err := os.Remove(store.templatePath(team, name))
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (store *dirStore) Templates() ([]builds.Template, error) {
+	entries, err := ioutil.ReadDir(filepath.Join(store.dir, "templates"))
+	if err != nil {
+		return nil, err
+	}
+
+	templates := []builds.Template{}
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+
+		payload, err := ioutil.ReadFile(filepath.Join(store.dir, "templates", entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		var template builds.Template
+		err = json.Unmarshal(payload, &template)
+		if err != nil {
+			return nil, err
+		}
+
+		templates = append(templates, template)
+	}
+
+	return templates, nil
+}
+
+func (store *dirStore) Check() error {
+	return writeFile(filepath.Join(store.dir, ".check"), []byte("ok"))
+}
+
+func (store *dirStore) buildPath(guid string) string {
+	return filepath.Join(store.dir, "builds", guid+".json")
+}
+
+func (store *dirStore) hijacksPath(guid string) string {
+	return filepath.Join(store.dir, "hijacks", guid)
+}
+
+// templatePath escapes the team and name, which are joined by a slash, so
+// that neither can reach outside of dir/templates.
+func (store *dirStore) templatePath(team string, name string) string {
+	return filepath.Join(store.dir, "templates", url.PathEscape(team+"/"+name)+".json")
+}
+
+// writeFile replaces the file at path atomically, so that a crash never leaves
+// a partially written file behind.
+func writeFile(path string, payload []byte) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+
+	_, err = tmp.Write(payload)
+	if err == nil {
+		err = tmp.Sync()
+	}
+
+	closeErr := tmp.Close()
+	if err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,168 @@
+package store
+
+import (
+	"sort"
+	"sync"
+
+	"github.com/concourse/glider/api/builds"
+)
+
+type memoryStore struct {
+	builds      map[string]Build
+	buildsMutex *sync.RWMutex
+
+	// hijack sessions and recordings, keyed by build guid and then session id
+	hijacks      map[string]map[string]builds.HijackSession
+	recordings   map[string]map[string][]byte
+	hijacksMutex *sync.RWMutex
+
+	// keyed by team and then name
+	templates      map[string]map[string]builds.Template
+	templatesMutex *sync.RWMutex
+}
+
+// NewMemoryStore returns a store that keeps builds only for the lifetime of
+// the process.
+func NewMemoryStore() Store {
+	return &memoryStore{
+		builds:      make(map[string]Build),
+		buildsMutex: new(sync.RWMutex),
+
+		hijacks:      make(map[string]map[string]builds.HijackSession),
+		recordings:   make(map[string]map[string][]byte),
+		hijacksMutex: new(sync.RWMutex),
+
+		templates:      make(map[string]map[string]builds.Template),
+		templatesMutex: new(sync.RWMutex),
+	}
+}
+
+func (store *memoryStore) SaveBuild(build Build) error {
+	store.buildsMutex.Lock()
+	store.builds[build.Guid] = build
+	store.buildsMutex.Unlock()
+
+	return nil
+}
+
+func (store *memoryStore) DeleteBuild(guid string) error {
+	store.buildsMutex.Lock()
+	delete(store.builds, guid)
+	store.buildsMutex.Unlock()
+
+	store.hijacksMutex.Lock()
+	delete(store.hijacks, guid)
+	delete(store.recordings, guid)
+	store.hijacksMutex.Unlock()
+
+	return nil
+}
+
+func (store *memoryStore) Builds() ([]Build, error) {
+	store.buildsMutex.RLock()
+	defer store.buildsMutex.RUnlock()
+
+	builds := make([]Build, 0, len(store.builds))
+	for _, build := range store.builds {
+		builds = append(builds, build)
+	}
+
+	return builds, nil
+}
+
+func (store *memoryStore) SaveHijack(session builds.HijackSession) error {
+	store.hijacksMutex.Lock()
+	defer store.hijacksMutex.Unlock()
+
+	sessions, found := store.hijacks[session.Build]
+	if !found {
+		sessions = make(map[string]builds.HijackSession)
+		store.hijacks[session.Build] = sessions
+	}
+
+	sessions[session.ID] = session
+
+	return nil
+}
+
+func (store *memoryStore) Hijacks(guid string) ([]builds.HijackSession, error) {
+	store.hijacksMutex.RLock()
+	defer store.hijacksMutex.RUnlock()
+
+	sessions := []builds.HijackSession{}
+	for _, session := range store.hijacks[guid] {
+		sessions = append(sessions, session)
+	}
+
+	sort.Sort(builds.HijackSessionsByStartedAt(sessions))
+
+	return sessions, nil
+}
+
+func (store *memoryStore) SaveRecording(guid string, id string, recording []byte) error {
+	store.hijacksMutex.Lock()
+	defer store.hijacksMutex.Unlock()
+
+	recordings, found := store.recordings[guid]
+	if !found {
+		recordings = make(map[string][]byte)
+		store.recordings[guid] = recordings
+	}
+
+	recordings[id] = recording
+
+	return nil
+}
+
+func (store *memoryStore) Recording(guid string, id string) ([]byte, error) {
+	store.hijacksMutex.RLock()
+	defer store.hijacksMutex.RUnlock()
+
+	recording, found := store.recordings[guid][id]
+	if !found {
+		return nil, ErrNotFound
+	}
+
+	return recording, nil
+}
+
+func (store *memoryStore) SaveTemplate(template builds.Template) error {
+	store.templatesMutex.Lock()
+	defer store.templatesMutex.Unlock()
+
+	templates, found := store.templates[template.Team]
+	if !found {
+		templates = make(map[string]builds.Template)
+		store.templates[template.Team] = templates
+	}
+
+	templates[template.Name] = template
+
+	return nil
+}
+
+func (store *memoryStore) DeleteTemplate(team string, name string) error {
+	store.templatesMutex.Lock()
+	delete(store.templates[team], name)
+	store.templatesMutex.Unlock()
+
+	return nil
+}
+
+func (store *memoryStore) Templates() ([]builds.Template, error) {
+	store.templatesMutex.RLock()
+	defer store.templatesMutex.RUnlock()
+
+	all := []builds.Template{}
+	for _, templates := range store.templates {
+		for _, template := range templates {
+			all = append(all, template)
+		}
+	}
+
+	return all, nil
+}
+
+func (store *memoryStore) Check() error {
+	return nil
+}
@@ -0,0 +1,55 @@
+package store
+
+import (
+	"errors"
+
+	"github.com/concourse/glider/api/builds"
+)
+
+// ErrNotFound is returned when looking up something that was never saved.
+var ErrNotFound = errors.New("not found")
+
+type Store interface {
+	SaveBuild(Build) error
+
+	// DeleteBuild removes the build along with its hijack sessions.
+	DeleteBuild(guid string) error
+	Builds() ([]Build, error)
+
+	SaveHijack(builds.HijackSession) error
+	Hijacks(guid string) ([]builds.HijackSession, error)
+
+	SaveRecording(guid string, id string, recording []byte) error
+	Recording(guid string, id string) ([]byte, error)
+
+	SaveTemplate(builds.Template) error
+	DeleteTemplate(team string, name string) error
+	Templates() ([]builds.Template, error)
+
+	// Check returns an error if the store cannot currently be written to.
+	Check() error
+}
+
+// Build is a build as persisted, including the turbine URLs that are not part
+// of the build's API representation.
+type Build struct {
+	builds.Build
+
+	HijackURL string `json:"hijack_url,omitempty"`
+	AbortURL  string `json:"abort_url,omitempty"`
+}
+
+func NewBuild(build builds.Build) Build {
+	return Build{
+		Build:     build,
+		HijackURL: build.HijackURL,
+		AbortURL:  build.AbortURL,
+	}
+}
+
+func (build Build) Restore() builds.Build {
+	restored := build.Build
+	restored.HijackURL = build.HijackURL
+	restored.AbortURL = build.AbortURL
+	return restored
+}
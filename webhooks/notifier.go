@@ -0,0 +1,265 @@
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/nu7hatch/gouuid"
+	"github.com/pivotal-golang/lager"
+
+	"github.com/concourse/glider/api/builds"
+)
+
+const (
+	EventHeader     = "X-Glider-Event"
+	DeliveryHeader  = "X-Glider-Delivery"
+	SignatureHeader = "X-Glider-Signature"
+)
+
+type Event string
+
+const (
+	EventCreated   Event = "created"
+	EventTriggered Event = "triggered"
+	EventStarted   Event = "started"
+	EventFinished  Event = "finished"
+)
+
+type Payload struct {
+	Event Event        `json:"event"`
+	Build builds.Build `json:"build"`
+}
+
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+type Delivery struct {
+	ID    string `json:"id"`
+	URL   string `json:"url"`
+	Event Event  `json:"event"`
+
+	Status         string `json:"status"`
+	Attempts       int    `json:"attempts"`
+	ResponseStatus int    `json:"response_status,omitempty"`
+	Error          string `json:"error,omitempty"`
+
+	CreatedAt   time.Time  `json:"created_at"`
+	DeliveredAt *time.Time `json:"delivered_at,omitempty"`
+}
+
+// deliveries kept for each build; the oldest are forgotten beyond this
+const maxDeliveriesPerBuild = 100
+
+// Notifier delivers build events to the globally configured webhooks and
+// to each build's own notify URLs.
+type Notifier struct {
+	logger lager.Logger
+
+	urls        []string
+	secret      []byte
+	maxAttempts int
+	backoff     time.Duration
+
+	client *http.Client
+
+	deliveries      map[string][]*Delivery
+	deliveriesMutex *sync.RWMutex
+}
+
+// NewNotifier constructs a notifier. Payloads are signed with secret, if
+// given. Failed deliveries are attempted up to maxAttempts times, waiting
+// backoff before the first retry and doubling it each time.
+func NewNotifier(
+	logger lager.Logger,
+	urls []string,
+	secret string,
+	maxAttempts int,
+	backoff time.Duration,
+) *Notifier {
+	var secretBytes []byte
+	if secret != "" {
+		secretBytes = []byte(secret)
+	}
+
+	return &Notifier{
+		logger: logger,
+
+		urls:        urls,
+		secret:      secretBytes,
+		maxAttempts: maxAttempts,
+		backoff:     backoff,
+
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+
+			// notify URLs are only checked as given, so a redirect could
+			// send the payload to a host they would not be allowed to name
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+
+		deliveries:      make(map[string][]*Delivery),
+		deliveriesMutex: new(sync.RWMutex),
+	}
+}
+
+// Notify delivers the event in the background.
+func (notifier *Notifier) Notify(event Event, build builds.Build) {
+	urls := append(append([]string{}, notifier.urls...), build.Notify...)
+	if len(urls) == 0 {
+		return
+	}
+
+	payload, err := json.Marshal(Payload{
+		Event: event,
+		Build: build,
+	})
+	if err != nil {
+		notifier.logger.Error("failed-to-marshal-payload", err)
+		return
+	}
+
+	for _, url := range urls {
+		id, err := uuid.NewV4()
+		if err != nil {
+			panic(err)
+		}
+
+		delivery := &Delivery{
+			ID:    id.String(),
+			URL:   url,
+			Event: event,
+
+			Status: DeliveryPending,
+
+			CreatedAt: time.Now(),
+		}
+
+		notifier.deliveriesMutex.Lock()
+		deliveries := append(notifier.deliveries[build.Guid], delivery)
+		if len(deliveries) > maxDeliveriesPerBuild {
+			deliveries = append([]*Delivery{}, deliveries[len(deliveries)-maxDeliveriesPerBuild:]...)
+		}
+
+		notifier.deliveries[build.Guid] = deliveries
+		notifier.deliveriesMutex.Unlock()
+
+		go notifier.deliver(build.Guid, delivery, payload)
+	}
+}
+
+// Deliveries returns the most recent deliveries made for the build, oldest
+// first.
+func (notifier *Notifier) Deliveries(guid string) []Delivery {
+	notifier.deliveriesMutex.RLock()
+	defer notifier.deliveriesMutex.RUnlock()
+
+	deliveries := make([]Delivery, len(notifier.deliveries[guid]))
+	for i, delivery := range notifier.deliveries[guid] {
+		deliveries[i] = *delivery
+	}
+
+	return deliveries
+}
+
+// Forget drops the record of the build's deliveries. Any still being
+// attempted carry on.
+func (notifier *Notifier) Forget(guid string) {
+	notifier.deliveriesMutex.Lock()
+	delete(notifier.deliveries, guid)
+	notifier.deliveriesMutex.Unlock()
+}
+
+func (notifier *Notifier) deliver(guid string, delivery *Delivery, payload []byte) {
+	log := notifier.logger.Session("deliver", lager.Data{
+		"guid":     guid,
+		"delivery": delivery.ID,
+		"url":      delivery.URL,
+		"event":    delivery.Event,
+	})
+
+	backoff := notifier.backoff
+
+	for attempt := 1; attempt <= notifier.maxAttempts; attempt++ {
+		status, err := notifier.post(delivery, payload)
+
+		notifier.deliveriesMutex.Lock()
+
+		delivery.Attempts = attempt
+		delivery.ResponseStatus = status
+
+		if err == nil {
+			now := time.Now()
+			delivery.Status = DeliveryDelivered
+			delivery.DeliveredAt = &now
+			delivery.Error = ""
+		} else {
+			delivery.Error = err.Error()
+
+			if attempt == notifier.maxAttempts {
+				delivery.Status = DeliveryFailed
+			}
+		}
+
+		notifier.deliveriesMutex.Unlock()
+
+		if err == nil {
+			log.Info("delivered", lager.Data{"attempts": attempt})
+			return
+		}
+
+		log.Error("failed-to-deliver", err, lager.Data{"attempt": attempt})
+
+		if attempt < notifier.maxAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+}
+
+func (notifier *Notifier) post(delivery *Delivery, payload []byte) (int, error) {
+	req, err := http.NewRequest("POST", delivery.URL, bytes.NewBuffer(payload))
+	if err != nil {
+		return 0, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, string(delivery.Event))
+	req.Header.Set(DeliveryHeader, delivery.ID)
+
+	if notifier.secret != nil {
+		req.Header.Set(SignatureHeader, Sign(notifier.secret, payload))
+	}
+
+	resp, err := notifier.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// Sign returns the value of the signature header for the payload, for
+// receivers to verify with hmac.Equal.
+func Sign(secret []byte, payload []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}